@@ -0,0 +1,405 @@
+// Command bmlcheck loads BulletML barrages, simulates them headlessly and
+// reports problems found in them.
+//
+// Usage:
+//
+//	bmlcheck [flags] [path ...]
+//
+// Each path is a BulletML file or a directory whose *.xml files are checked.
+// The resources directory is checked if no path is given. Each file is
+// stepped in the game simulation as the only barrage of a stage, with the
+// player standing still at its home. Files listed in the stage manifest are
+// run by the boss or popcorn enemies as in the stage, and the -body flag
+// decides for the other files. The exit status is non-zero if any barrage
+// has an error.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tsujio/game-bullet-hell/sim"
+	"github.com/tsujio/game-util/mathutil"
+	"github.com/tsujio/go-bulletml"
+)
+
+var (
+	ticks      = flag.Int("ticks", 3600, "number of ticks to simulate")
+	maxBullets = flag.Int("max-bullets", 2000, "maximum number of simultaneous bullets")
+	staleTicks = flag.Int("stale-ticks", 1200, "ticks after which a bullet still alive on screen is reported as never vanishing")
+	stagePath  = flag.String("stage", "resources/stage.json", "stage manifest telling boss barrages from popcorn barrages")
+	body       = flag.Bool("body", true, "treat the first bullet fired by the top action as the enemy body, as boss barrages do, in files not listed in the stage")
+)
+
+type report struct {
+	path          string
+	errors        []string
+	simulated     bool
+	peakBullets   int
+	peakTick      int
+	neverVanished int
+}
+
+func (r *report) errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [path ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"resources"}
+	}
+
+	files, err := collectFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := false
+
+	stages, err := loadStages(*stagePath)
+	if err != nil {
+		fmt.Printf("%s:\n  error: %v\n", *stagePath, err)
+		failed = true
+	}
+
+	for _, f := range files {
+		r := check(f, stages[fileKey(f)])
+
+		fmt.Printf("%s:\n", r.path)
+		for _, e := range r.errors {
+			fmt.Printf("  error: %s\n", e)
+		}
+		if r.simulated {
+			fmt.Printf("  peak bullets: %d (tick %d)\n", r.peakBullets, r.peakTick)
+			fmt.Printf("  never vanished: %d\n", r.neverVanished)
+		}
+
+		if len(r.errors) > 0 {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func collectFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(p, "*.xml"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// loadStages reads the stage manifest and returns a stage for each barrage
+// file listed in it, in which the file is run at once by the boss or by a
+// popcorn enemy of its first wave. The files are keyed by fileKey.
+func loadStages(manifestPath string) (map[string]*sim.Stage, error) {
+	stages := make(map[string]*sim.Stage)
+
+	dir := filepath.Dir(manifestPath)
+	stage, err := sim.LoadStage(os.DirFS(dir), filepath.Base(manifestPath))
+	if err != nil {
+		return stages, err
+	}
+
+	for _, b := range stage.Barrages {
+		k := fileKey(filepath.Join(dir, filepath.FromSlash(b.Path)))
+		if _, exists := stages[k]; !exists {
+			stages[k] = bossStage(b)
+		}
+	}
+	for _, w := range stage.Waves {
+		k := fileKey(filepath.Join(dir, filepath.FromSlash(w.Barrage.Path)))
+		if _, exists := stages[k]; !exists {
+			stages[k] = waveStage(w)
+		}
+	}
+
+	return stages, nil
+}
+
+// bossStage returns the stage in which the boss runs the barrage from the
+// first tick until the end of the check.
+func bossStage(b *sim.Barrage) *sim.Stage {
+	bb := *b
+	bb.Delay = 0
+	bb.TimeLimit = 0
+	bb.Survival = false
+	return &sim.Stage{Barrages: []*sim.Barrage{&bb}}
+}
+
+// waveStage returns the stage in which a popcorn enemy of the wave runs its
+// barrage from the first tick, while the boss waits until the end of the
+// check.
+func waveStage(w *sim.Wave) *sim.Stage {
+	ww := *w
+	ww.SpawnAt = 0
+	ww.Count = 1
+	bb := *w.Barrage
+	ww.Barrage = &bb
+	idle := &sim.Barrage{EnemyLife: 1, Delay: *ticks + 1}
+	return &sim.Stage{Waves: []*sim.Wave{&ww}, Barrages: []*sim.Barrage{idle}}
+}
+
+// defaultStage returns the stage of a file not listed in the manifest. The
+// barrage is run by the boss if body is true, and otherwise by a popcorn
+// enemy which stays at the home of the boss.
+func defaultStage(path string, body bool) *sim.Stage {
+	b := &sim.Barrage{Path: path, EnemyLife: 1}
+	if body {
+		return bossStage(b)
+	}
+
+	home := mathutil.NewVector2D(sim.ScreenWidth/2, sim.ScreenHeight/5)
+	return waveStage(&sim.Wave{
+		Waypoints: []*mathutil.Vector2D{home, home.Add(mathutil.NewVector2D(0, 1))},
+		Speed:     1 / float64(*ticks+1),
+		Barrage:   b,
+	})
+}
+
+// fileKey returns the absolute path of the file, or the cleaned path if it
+// can not be made absolute.
+func fileKey(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
+
+// check checks the file, which is run in the stage, or in the default stage
+// if the stage is nil.
+func check(path string, stage *sim.Stage) *report {
+	r := &report{path: path}
+
+	f, err := os.Open(path)
+	if err != nil {
+		r.errorf("%v", err)
+		return r
+	}
+	defer f.Close()
+
+	bml, err := bulletml.Load(f)
+	if err != nil {
+		r.errorf("%v", err)
+		return r
+	}
+
+	hang := false
+	for _, c := range findRecursions(bml) {
+		if c.waits {
+			r.errorf("runaway recursion: %s", strings.Join(c.labels, " -> "))
+		} else {
+			r.errorf("runaway recursion without <wait>: %s", strings.Join(c.labels, " -> "))
+			hang = true
+		}
+	}
+
+	// A recursion without any wait never returns from Update, so the
+	// simulation is skipped in that case.
+	if !hang {
+		if stage == nil {
+			stage = defaultStage(path, *body)
+		}
+		simulate(stage, bml, r)
+	}
+
+	return r
+}
+
+// simulate steps the stage with the barrage replaced with bml, and reports
+// the bullets on screen.
+func simulate(stage *sim.Stage, bml *bulletml.BulletML, r *report) {
+	if len(stage.Waves) > 0 {
+		stage.Waves[0].Barrage.BulletML = bml
+	} else {
+		stage.Barrages[0].BulletML = bml
+	}
+
+	g := sim.NewGame(stage, sim.Difficulties[1], 0)
+	g.Player.KeepInvincible()
+
+	r.simulated = true
+
+	firedAt := make(map[*sim.Bullet]int)
+	exceeded := false
+	tick := 1
+	for ; tick <= *ticks; tick++ {
+		if err := g.Step(sim.InputFrame{}); err != nil {
+			// The path of the barrage is already in the report.
+			var be *sim.BarrageError
+			if errors.As(err, &be) {
+				err = be.Err
+			}
+			r.errorf("tick %d: %v", tick, err)
+			return
+		}
+
+		alive := make(map[*sim.Bullet]int, len(g.Bullets))
+		for _, b := range g.Bullets {
+			if t, exists := firedAt[b]; exists {
+				alive[b] = t
+			} else {
+				alive[b] = tick
+			}
+		}
+		firedAt = alive
+
+		if len(g.Bullets) > r.peakBullets {
+			r.peakBullets = len(g.Bullets)
+			r.peakTick = tick
+		}
+
+		if !exceeded && len(g.Bullets) > *maxBullets {
+			r.errorf("tick %d: %d bullets exceed the limit %d", tick, len(g.Bullets), *maxBullets)
+			exceeded = true
+		}
+	}
+
+	for _, t := range firedAt {
+		if tick-t > *staleTicks {
+			r.neverVanished++
+		}
+	}
+	if r.neverVanished > 0 {
+		r.errorf("%d bullets stay on screen for more than %d ticks", r.neverVanished, *staleTicks)
+	}
+}
+
+type recursion struct {
+	labels []string
+	waits  bool
+}
+
+// findRecursions returns cycles of labeled actions which call themselves
+// through <actionRef>. The runner keeps a stack frame for every reference,
+// so such a cycle grows the stack for as long as the bullet is alive.
+func findRecursions(bml *bulletml.BulletML) []recursion {
+	actions := make(map[string]*bulletml.Action)
+	for i := range bml.Actions {
+		if a := &bml.Actions[i]; a.Label != "" {
+			actions[a.Label] = a
+		}
+	}
+
+	labels := make([]string, 0, len(actions))
+	for l := range actions {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+
+	var (
+		result  []recursion
+		visited = make(map[string]bool)
+		onStack = make(map[string]int)
+		stack   []string
+		visit   func(label string)
+	)
+
+	visit = func(label string) {
+		visited[label] = true
+		onStack[label] = len(stack)
+		stack = append(stack, label)
+
+		for _, ref := range actionRefs(actions[label]) {
+			if _, exists := actions[ref]; !exists {
+				continue
+			}
+
+			if i, exists := onStack[ref]; exists {
+				cycle := append(append([]string{}, stack[i:]...), ref)
+				waits := false
+				for _, l := range cycle {
+					if containsWait(actions[l]) {
+						waits = true
+					}
+				}
+				result = append(result, recursion{labels: cycle, waits: waits})
+			} else if !visited[ref] {
+				visit(ref)
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		delete(onStack, label)
+	}
+
+	for _, l := range labels {
+		if !visited[l] {
+			visit(l)
+		}
+	}
+
+	return result
+}
+
+// actionRefs returns the labels of actions run in the same process as the
+// given action. Actions of fired bullets run in other processes and are not
+// included.
+func actionRefs(action *bulletml.Action) []string {
+	var refs []string
+	for _, c := range action.Commands {
+		switch c := c.(type) {
+		case bulletml.ActionRef:
+			refs = append(refs, c.Label)
+		case bulletml.Action:
+			refs = append(refs, actionRefs(&c)...)
+		case bulletml.Repeat:
+			if c.ActionRef != nil {
+				refs = append(refs, c.ActionRef.Label)
+			}
+			if c.Action != nil {
+				refs = append(refs, actionRefs(c.Action)...)
+			}
+		}
+	}
+	return refs
+}
+
+func containsWait(action *bulletml.Action) bool {
+	for _, c := range action.Commands {
+		switch c := c.(type) {
+		case bulletml.Wait:
+			return true
+		case bulletml.Action:
+			if containsWait(&c) {
+				return true
+			}
+		case bulletml.Repeat:
+			if c.Action != nil && containsWait(c.Action) {
+				return true
+			}
+		}
+	}
+	return false
+}
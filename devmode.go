@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsujio/game-bullet-hell/sim"
+)
+
+const (
+	barrageWatchInterval = 30
+	stageManifestName    = "stage.json"
+)
+
+// barrageWatcher polls the stage manifest and the barrage files of the stage
+// and reports the ones modified since the previous poll. errors holds the
+// error of the last reload of each file which failed.
+type barrageWatcher struct {
+	ticks    int
+	fsys     fs.FS
+	modTimes map[string]time.Time
+	errors   map[string]string
+}
+
+func newBarrageWatcher(fsys fs.FS) *barrageWatcher {
+	return &barrageWatcher{
+		fsys:     fsys,
+		modTimes: make(map[string]time.Time),
+		errors:   make(map[string]string),
+	}
+}
+
+func (w *barrageWatcher) update() []string {
+	w.ticks++
+	if w.ticks%barrageWatchInterval != 0 {
+		return nil
+	}
+
+	paths := []string{stageManifestName}
+	for _, b := range stage.AllBarrages() {
+		if !isIn(b.Path, paths...) {
+			paths = append(paths, b.Path)
+		}
+	}
+
+	var changed []string
+	for _, p := range paths {
+		info, err := fs.Stat(w.fsys, p)
+		if err != nil {
+			continue
+		}
+
+		if t, exists := w.modTimes[p]; exists && !t.Equal(info.ModTime()) {
+			changed = append(changed, p)
+		}
+		w.modTimes[p] = info.ModTime()
+	}
+
+	return changed
+}
+
+// errorText returns the errors of the files in the order of their paths.
+func (w *barrageWatcher) errorText() string {
+	var paths []string
+	for p := range w.errors {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var errs []string
+	for _, p := range paths {
+		errs = append(errs, w.errors[p])
+	}
+	return strings.Join(errs, "\n")
+}
+
+func (g *Game) reloadFile(p string) {
+	if p == stageManifestName {
+		g.reloadStage()
+	} else {
+		g.reloadBarrage(p)
+	}
+}
+
+// reloadStage replaces the stage with the one in the manifest, which takes
+// effect from the next run. All the files of the stage are loaded again, so
+// the errors of all of them are cleared on success.
+func (g *Game) reloadStage() {
+	w := g.barrageWatcher
+
+	s, err := sim.LoadStage(w.fsys, stageManifestName)
+	if err != nil {
+		w.errors[stageManifestName] = err.Error()
+		return
+	}
+
+	stage = s
+	w.errors = make(map[string]string)
+}
+
+func (g *Game) reloadBarrage(p string) {
+	w := g.barrageWatcher
+
+	bml, err := sim.LoadBulletML(w.fsys, p)
+	if err != nil {
+		w.errors[p] = err.Error()
+		return
+	}
+	delete(w.errors, p)
+
+	for _, b := range stage.AllBarrages() {
+		if b.Path == p {
+			b.BulletML = bml
+		}
+	}
+
+	// The hash identifies the files replays are recorded on, so it is taken
+	// from the whole stage loaded again.
+	if s, err := sim.LoadStage(w.fsys, stageManifestName); err == nil {
+		stage.Hash = s.Hash
+	}
+
+	if g.mode != GameModePlaying {
+		return
+	}
+
+	g.reloadedInRun = true
+
+	if err := g.sim.RestartBarrage(p); err != nil {
+		w.errors[p] = err.Error()
+	}
+}
+
+// abortRun shows the error of a barrage in the development mode and returns
+// to the title instead of quitting the game. The error stays until the file
+// is reloaded. It reports whether the error is handled.
+func (g *Game) abortRun(err error) bool {
+	var be *sim.BarrageError
+	if g.barrageWatcher == nil || !errors.As(err, &be) {
+		return false
+	}
+
+	g.barrageWatcher.errors[be.Path] = err.Error()
+	g.initialize()
+
+	return true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/tsujio/game-bullet-hell/sim"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+const scoresName = "scores.json"
+
+// ScoreRecord is the result of a finished run. The rank history is kept only
+// while the game runs.
+type ScoreRecord struct {
+	Score       int
+	Graze       int
+	Difficulty  *sim.Difficulty
+	RankHistory []sim.RankSample
+}
+
+// savedScoreRecord is a ScoreRecord saved with the name of its difficulty.
+type savedScoreRecord struct {
+	Score      int    `json:"score"`
+	Graze      int    `json:"graze"`
+	Difficulty string `json:"difficulty"`
+}
+
+// loadScoreRecords reads the saved records. Records of unknown difficulties
+// are skipped.
+func (g *Game) loadScoreRecords() error {
+	data, err := loadData(scoresName)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var saved []savedScoreRecord
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	for _, r := range saved {
+		if d := sim.DifficultyByName(r.Difficulty); d != nil {
+			g.scoreRecords = append(g.scoreRecords, ScoreRecord{
+				Score:      r.Score,
+				Graze:      r.Graze,
+				Difficulty: d,
+			})
+		}
+	}
+
+	return nil
+}
+
+func (g *Game) saveScoreRecords() error {
+	saved := make([]savedScoreRecord, 0, len(g.scoreRecords))
+	for _, r := range g.scoreRecords {
+		saved = append(saved, savedScoreRecord{
+			Score:      r.Score,
+			Graze:      r.Graze,
+			Difficulty: r.Difficulty.Name,
+		})
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	return saveData(scoresName, data)
+}
+
+// setDifficulty selects the difficulty on the title screen.
+func (g *Game) setDifficulty(d *sim.Difficulty) {
+	g.difficulty = d
+	g.sim = newTitleSim(d)
+}
+
+func (g *Game) bestScore(d *sim.Difficulty) (ScoreRecord, bool) {
+	var best ScoreRecord
+	found := false
+	for _, r := range g.scoreRecords {
+		if r.Difficulty == d && (!found || r.Score > best.Score) {
+			best = r
+			found = true
+		}
+	}
+	return best, found
+}
+
+const (
+	difficultyTextY       = 170
+	difficultyTextSpacing = 22
+)
+
+// The title screen lists the difficulties followed by the settings and the
+// replay rows.
+var (
+	titleRowSettings = len(sim.Difficulties)
+	titleRowReplay   = titleRowSettings + 1
+)
+
+// titleRowAt returns the title screen row containing pos, or -1 if none.
+func titleRowAt(pos *mathutil.Vector2D) int {
+	for i := 0; i <= titleRowReplay; i++ {
+		y := float64(difficultyTextY + i*difficultyTextSpacing)
+		if pos.Y > y-float64(difficultyTextSpacing)+4 && pos.Y <= y+4 {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/tsujio/game-bullet-hell/sim"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+// Effects are the visual effects of the events of the simulation. They have
+// their own random generator so that they never change the play.
+type Effects struct {
+	ticks     int
+	random    *rand.Rand
+	flashes   []*flashEffect
+	fragments []*enemyFragment
+}
+
+func newEffects() *Effects {
+	return &Effects{
+		random: rand.New(rand.NewSource(0)),
+	}
+}
+
+type flashEffect struct {
+	ticks int
+	pos   *mathutil.Vector2D
+	r     float64
+	v     *mathutil.Vector2D
+	color color.Color
+	until int
+}
+
+type enemyFragment struct {
+	ticks int
+	pos   *mathutil.Vector2D
+	v     *mathutil.Vector2D
+}
+
+// update moves the effects by a tick and adds the ones of the events of the
+// tick just stepped in s.
+func (ef *Effects) update(s *sim.Game) {
+	for _, f := range ef.flashes {
+		f.ticks++
+		if f.v != nil {
+			f.pos = f.pos.Add(f.v)
+		}
+	}
+
+	for _, f := range ef.fragments {
+		f.pos = f.pos.Add(f.v)
+		f.ticks++
+	}
+
+	for _, e := range s.Events {
+		ef.addEvent(s, e)
+	}
+
+	for _, e := range s.Enemies {
+		if e.State == sim.EnemyStateFlashing && e.Ticks%15 == 0 {
+			ef.flashes = append(ef.flashes, &flashEffect{
+				pos:   e.Pos.Add(mathutil.NewVector2D(50*ef.random.Float64()-25, 50*ef.random.Float64()-25)),
+				r:     60 * e.R / sim.EnemyR,
+				color: color.Black,
+				until: 30,
+			})
+		}
+	}
+
+	_flashes := ef.flashes[:0]
+	for _, f := range ef.flashes {
+		if f.ticks < f.until {
+			_flashes = append(_flashes, f)
+		}
+	}
+	ef.flashes = _flashes
+
+	_fragments := ef.fragments[:0]
+	for _, f := range ef.fragments {
+		if f.pos.Sub(mathutil.NewVector2D(screenWidth/2, screenHeight/2)).NormSq() < 500*500 {
+			_fragments = append(_fragments, f)
+		}
+	}
+	ef.fragments = _fragments
+
+	ef.ticks++
+}
+
+func (ef *Effects) addEvent(s *sim.Game, e sim.Event) {
+	switch e.Kind {
+	case sim.EventBulletCanceled:
+		ef.flashes = append(ef.flashes, &flashEffect{
+			pos:   e.Pos,
+			r:     10,
+			color: color.Gray{0x70},
+			until: 25,
+		})
+	case sim.EventEnemyHit:
+		ef.flashes = append(ef.flashes, &flashEffect{
+			pos:   e.Pos.Add(mathutil.NewVector2D(10*ef.random.Float64()-5, 10*ef.random.Float64()-5)),
+			r:     10,
+			color: color.Gray{0x70},
+			until: 25,
+		})
+	case sim.EventGraze:
+		for i := 0; i < 3; i++ {
+			ef.flashes = append(ef.flashes, &flashEffect{
+				pos: e.Pos.Add(s.Player.Pos).Div(2),
+				v: e.Pos.Sub(s.Player.Pos).Add(mathutil.NewVector2D(
+					5*ef.random.NormFloat64(),
+					5*ef.random.NormFloat64(),
+				)).Normalize().Mul(0.6 + 0.2*ef.random.NormFloat64()),
+				r:     3,
+				color: color.RGBA{0x80, 0, 0, 0xff},
+				until: 15,
+			})
+		}
+	case sim.EventLaserGraze:
+		if ef.ticks%4 == 0 {
+			ef.flashes = append(ef.flashes, &flashEffect{
+				pos:   e.Pos,
+				v:     mathutil.NewVector2D(ef.random.NormFloat64(), ef.random.NormFloat64()).Normalize().Mul(0.6),
+				r:     3,
+				color: color.RGBA{0x80, 0, 0, 0xff},
+				until: 15,
+			})
+		}
+	case sim.EventMiss:
+		ef.flashes = append(ef.flashes, &flashEffect{
+			pos:   e.Pos,
+			r:     40,
+			color: color.RGBA{0xff, 0, 0, 0xff},
+			until: 25,
+		})
+	case sim.EventEnemyExploded:
+		for i, n := 0, int(50*e.R/sim.EnemyR); i < n; i++ {
+			s := 2 + 4*ef.random.Float64()
+			d := math.Pi * 2 * ef.random.Float64()
+			ef.fragments = append(ef.fragments, &enemyFragment{
+				pos: e.Pos.Clone(),
+				v:   mathutil.NewVector2D(s*math.Cos(d), s*math.Sin(d)),
+			})
+		}
+	}
+}
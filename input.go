@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/tsujio/game-bullet-hell/sim"
+	"github.com/tsujio/game-bullet-hell/touchutil"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+const bindingsName = "bindings.json"
+
+// Action is an input of the game independent of devices. The bindings of the
+// direction actions are passed to touchutil, which produces touches of them,
+// and movement is the sum of the drags of the touches, so that all the devices
+// move the player together. Only the first finger on the screen moves it, and
+// the drag of the keyboard and gamepads is kept apart from the drag of
+// pointers, since only the former slows down while focused.
+type Action int
+
+const (
+	ActionFocus Action = iota
+	ActionBomb
+	ActionPause
+	ActionConfirm
+	ActionCancel
+	ActionUp
+	ActionDown
+	ActionLeft
+	ActionRight
+	actionCount
+)
+
+var actionNames = map[Action]string{
+	ActionFocus:   "focus",
+	ActionBomb:    "bomb",
+	ActionPause:   "pause",
+	ActionConfirm: "confirm",
+	ActionCancel:  "cancel",
+	ActionUp:      "up",
+	ActionDown:    "down",
+	ActionLeft:    "left",
+	ActionRight:   "right",
+}
+
+var actionDirections = map[Action]*mathutil.Vector2D{
+	ActionUp:    mathutil.NewVector2D(0, -1),
+	ActionDown:  mathutil.NewVector2D(0, 1),
+	ActionLeft:  mathutil.NewVector2D(-1, 0),
+	ActionRight: mathutil.NewVector2D(1, 0),
+}
+
+// Binding is the keys and standard gamepad buttons which trigger an action.
+type Binding struct {
+	Keys           []ebiten.Key                   `json:"keys"`
+	GamepadButtons []ebiten.StandardGamepadButton `json:"gamepadButtons"`
+}
+
+func defaultBindings() map[Action]*Binding {
+	return map[Action]*Binding{
+		ActionFocus: {
+			Keys:           []ebiten.Key{ebiten.KeyShift},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonFrontTopRight},
+		},
+		ActionBomb: {
+			Keys:           []ebiten.Key{ebiten.KeyX},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightLeft},
+		},
+		ActionPause: {
+			Keys:           []ebiten.Key{ebiten.KeyEscape},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonCenterRight},
+		},
+		ActionConfirm: {
+			Keys:           []ebiten.Key{ebiten.KeyZ},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightBottom},
+		},
+		ActionCancel: {
+			Keys:           []ebiten.Key{ebiten.KeyBackspace},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonRightRight},
+		},
+		ActionUp: {
+			Keys:           []ebiten.Key{ebiten.KeyArrowUp, ebiten.KeyW},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftTop},
+		},
+		ActionDown: {
+			Keys:           []ebiten.Key{ebiten.KeyArrowDown, ebiten.KeyS},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftBottom},
+		},
+		ActionLeft: {
+			Keys:           []ebiten.Key{ebiten.KeyArrowLeft, ebiten.KeyA},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftLeft},
+		},
+		ActionRight: {
+			Keys:           []ebiten.Key{ebiten.KeyArrowRight, ebiten.KeyD},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftRight},
+		},
+	}
+}
+
+var gamepadButtonNames = map[ebiten.StandardGamepadButton]string{
+	ebiten.StandardGamepadButtonRightBottom:      "A",
+	ebiten.StandardGamepadButtonRightRight:       "B",
+	ebiten.StandardGamepadButtonRightLeft:        "X",
+	ebiten.StandardGamepadButtonRightTop:         "Y",
+	ebiten.StandardGamepadButtonFrontTopLeft:     "L1",
+	ebiten.StandardGamepadButtonFrontTopRight:    "R1",
+	ebiten.StandardGamepadButtonFrontBottomLeft:  "L2",
+	ebiten.StandardGamepadButtonFrontBottomRight: "R2",
+	ebiten.StandardGamepadButtonCenterLeft:       "SELECT",
+	ebiten.StandardGamepadButtonCenterRight:      "START",
+	ebiten.StandardGamepadButtonLeftStick:        "L3",
+	ebiten.StandardGamepadButtonRightStick:       "R3",
+	ebiten.StandardGamepadButtonLeftTop:          "UP",
+	ebiten.StandardGamepadButtonLeftBottom:       "DOWN",
+	ebiten.StandardGamepadButtonLeftLeft:         "LEFT",
+	ebiten.StandardGamepadButtonLeftRight:        "RIGHT",
+	ebiten.StandardGamepadButtonCenterCenter:     "HOME",
+}
+
+// Input maps touches, the keyboard and gamepads to actions every tick. A tap
+// of the first finger or the mouse also confirms, and a tap of a second
+// finger also bombs.
+type Input struct {
+	tracker     *touchutil.Tracker
+	bindings    map[Action]*Binding
+	pressed     [actionCount]bool
+	justPressed [actionCount]bool
+	move        *mathutil.Vector2D
+	drag        *mathutil.Vector2D
+	tap         *mathutil.Vector2D
+	gamepadIDs  []ebiten.GamepadID
+}
+
+func newInput(src touchutil.InputSource) *Input {
+	in := &Input{
+		tracker: touchutil.NewTracker(src, sim.PlayerSpeed),
+		move:    mathutil.NewVector2D(0, 0),
+		drag:    mathutil.NewVector2D(0, 0),
+	}
+	in.setBindings(defaultBindings())
+	return in
+}
+
+func (in *Input) update(touches []touchutil.Touch) {
+	src := in.tracker.Source()
+
+	in.gamepadIDs = src.AppendGamepadIDs(in.gamepadIDs[:0])
+
+	for a := Action(0); a < actionCount; a++ {
+		pressed := in.bindingPressed(src, in.bindings[a])
+		in.justPressed[a] = pressed && !in.pressed[a]
+		in.pressed[a] = pressed
+	}
+
+	in.move = mathutil.NewVector2D(0, 0)
+	in.drag = mathutil.NewVector2D(0, 0)
+	in.tap = nil
+
+	fingers := 0
+	for i, t := range touches {
+		typ := t.ID().Type()
+		if typ == touchutil.TouchTypeScreenTouch {
+			fingers++
+		}
+
+		if prev := t.PreviousPosition(); prev != nil {
+			d := t.Position().Sub(prev)
+			switch {
+			case isIn(typ, touchutil.TouchTypeKeyboard, touchutil.TouchTypeGamepad):
+				in.move = in.move.Add(d)
+			case typ == touchutil.TouchTypeMouseButtonPress,
+				typ == touchutil.TouchTypeScreenTouch && fingers == 1:
+				in.drag = in.drag.Add(d)
+			}
+		}
+
+		if !t.IsJustTouched() {
+			continue
+		}
+		if i == 0 && isIn(typ, touchutil.TouchTypeMouseButtonPress, touchutil.TouchTypeScreenTouch) {
+			in.tap = t.Position()
+			in.justPressed[ActionConfirm] = true
+		}
+		if typ == touchutil.TouchTypeScreenTouch && fingers >= 2 {
+			in.justPressed[ActionBomb] = true
+		}
+	}
+}
+
+func (in *Input) bindingPressed(src touchutil.InputSource, b *Binding) bool {
+	for _, k := range b.Keys {
+		if src.IsKeyPressed(k) {
+			return true
+		}
+	}
+
+	for _, id := range in.gamepadIDs {
+		if !src.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		for _, btn := range b.GamepadButtons {
+			if src.IsStandardGamepadButtonPressed(id, btn) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (in *Input) frame() sim.InputFrame {
+	return sim.InputFrame{
+		MoveX: int(math.Round(in.move.X * sim.InputMoveScale)),
+		MoveY: int(math.Round(in.move.Y * sim.InputMoveScale)),
+		DragX: int(math.Round(in.drag.X * sim.InputMoveScale)),
+		DragY: int(math.Round(in.drag.Y * sim.InputMoveScale)),
+		Focus: in.pressed[ActionFocus],
+		Bomb:  in.justPressed[ActionBomb],
+	}
+}
+
+// justPressedDevice returns a key or a standard gamepad button just pressed.
+func (in *Input) justPressedDevice() (*ebiten.Key, *ebiten.StandardGamepadButton) {
+	src := in.tracker.Source()
+
+	if keys := src.AppendJustPressedKeys(nil); len(keys) > 0 {
+		return &keys[0], nil
+	}
+
+	for _, id := range in.gamepadIDs {
+		if !src.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		if buttons := src.AppendJustPressedStandardGamepadButtons(id, nil); len(buttons) > 0 {
+			return nil, &buttons[0]
+		}
+	}
+
+	return nil, nil
+}
+
+// setBindings replaces the bindings and passes the bindings of the direction
+// actions to the tracker.
+func (in *Input) setBindings(bindings map[Action]*Binding) {
+	in.bindings = bindings
+
+	var moves []touchutil.MoveBinding
+	for a, dir := range actionDirections {
+		b := bindings[a]
+		moves = append(moves, touchutil.MoveBinding{
+			Dir:            dir,
+			Keys:           b.Keys,
+			GamepadButtons: b.GamepadButtons,
+		})
+	}
+	in.tracker.SetMoveBindings(moves)
+}
+
+// loadBindings overrides the default bindings with the saved ones. Saved
+// bindings without any key or button are ignored, since the action could not
+// be triggered at all.
+func (in *Input) loadBindings() error {
+	data, err := loadData(bindingsName)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var saved map[string]*Binding
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	bindings := defaultBindings()
+	for a, name := range actionNames {
+		if b := saved[name]; b != nil && len(b.Keys)+len(b.GamepadButtons) > 0 {
+			bindings[a] = b
+		}
+	}
+	in.setBindings(bindings)
+
+	return nil
+}
+
+func (in *Input) saveBindings() error {
+	saved := make(map[string]*Binding)
+	for a, name := range actionNames {
+		saved[name] = in.bindings[a]
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	return saveData(bindingsName, data)
+}
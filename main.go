@@ -3,42 +3,30 @@ package main
 import (
 	"embed"
 	"fmt"
-	"image"
 	"image/color"
 	"log"
-	"math"
 	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/text"
-	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/tsujio/game-bullet-hell/sim"
 	"github.com/tsujio/game-bullet-hell/touchutil"
 	"github.com/tsujio/game-util/mathutil"
 	"github.com/tsujio/game-util/resourceutil"
-	"github.com/tsujio/go-bulletml"
 )
 
 const (
-	gameName                 = "bullet-hell"
-	screenWidth              = 640
-	screenHeight             = 480
-	playerR                  = 4
-	playerGrazeR             = 8
-	playerBulletR            = 3
-	enemyR                   = 20
-	bulletR                  = 3
-	playerHomeX, playerHomeY = screenWidth / 2, screenHeight * 4 / 5
-	enemyHomeX, enemyHomeY   = screenWidth / 2, screenHeight * 1 / 5
-	playerInitialLife        = 6
-	bulletMLGain             = 1000
-	zeroFailureGain          = 1000
-	oneFailureGain           = 500
-	grazeGain                = 10
+	gameName     = "bullet-hell"
+	screenWidth  = sim.ScreenWidth
+	screenHeight = sim.ScreenHeight
+
+	devErrorDisplayTicks = 60 * 5
 )
 
-//go:embed resources/*.ttf resources/*.xml
+//go:embed resources/*.ttf resources/*.xml resources/*.json
 var resources embed.FS
 
 var (
@@ -46,61 +34,15 @@ var (
 	_, _, fontSS        = resourceutil.ForceLoadFont(resources, "resources/PressStart2P-Regular.ttf", &resourceutil.LoadFontOption{
 		SmallSize: 8,
 	})
-	emptyImg,
-	playerImg,
-	playerBulletImg,
-	enemyImg,
-	bulletImg *ebiten.Image
-	playerLifeImgs []*ebiten.Image
-	flashImg       *ebiten.Image
-	bulletMLs      []*bulletml.BulletML
+	stage *sim.Stage
 )
 
 func init() {
-	img := ebiten.NewImage(3, 3)
-	img.Fill(color.White)
-	emptyImg = img.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
-
-	playerImg = ebiten.NewImage(playerR*2, playerR*2)
-	vector.DrawFilledCircle(playerImg, playerR, playerR, playerR, color.RGBA{0xff, 0, 0, 0xff}, true)
-
-	playerBulletImg = ebiten.NewImage(playerBulletR*2, playerBulletR*2)
-	vector.DrawFilledCircle(playerBulletImg, playerBulletR, playerBulletR, playerBulletR, color.Black, true)
-
-	enemyImg = ebiten.NewImage(enemyR*2, enemyR*2)
-	vector.DrawFilledRect(enemyImg, 0, 0, enemyR*2, enemyR*2, color.Black, true)
-
-	bulletImg = ebiten.NewImage(bulletR*2, bulletR*2)
-	vector.DrawFilledCircle(bulletImg, bulletR, bulletR, bulletR, color.Black, true)
-
-	for life := 1; life <= playerInitialLife; life++ {
-		img = ebiten.NewImage(70, 70)
-		w, _ := img.Size()
-		for i, n := 0, life-1; i < n; i++ {
-			x := float32(float64(w)/2 + (float64(w)/2-2)*math.Cos(math.Pi*2*float64(i)/float64(n)-math.Pi/2))
-			y := float32(float64(w)/2 + (float64(w)/2-2)*math.Sin(math.Pi*2*float64(i)/float64(n)-math.Pi/2))
-			vector.DrawFilledCircle(img, x, y, 2, color.RGBA{0, 0, 0, 0x70}, true)
-		}
-		playerLifeImgs = append(playerLifeImgs, img)
-	}
-
-	flashImg = ebiten.NewImage(500, 500)
-	vector.DrawFilledCircle(flashImg, 250, 250, 250, color.White, true)
-
-	for _, p := range []string{"barrage-1.xml", "barrage-1.xml"} {
-		f, err := resources.Open("resources/" + p)
-		if err != nil {
-			panic(err)
-		}
-		defer f.Close()
-
-		bml, err := bulletml.Load(f)
-		if err != nil {
-			panic(err)
-		}
-
-		bulletMLs = append(bulletMLs, bml)
+	s, err := sim.LoadStage(resources, "resources/stage.json")
+	if err != nil {
+		panic(err)
 	}
+	stage = s
 }
 
 func isIn[T comparable](v T, values ...T) bool {
@@ -112,646 +54,155 @@ func isIn[T comparable](v T, values ...T) bool {
 	return false
 }
 
-type EnemyState int
-
-const (
-	EnemyStateWaiting = iota
-	EnemyStateRunning
-	EnemyStateFlashing
-	EnemyStateExploded
-)
-
-type Enemy struct {
-	ticks               int
-	pos, prevPos        *mathutil.Vector2D
-	r                   float64
-	state               EnemyState
-	hit                 bool
-	life                float64
-	bulletMLIndex       int
-	startNextBulletMLAt int
-	explodeAt           int
-	runner              bulletml.BulletRunner
-	game                *Game
-}
-
-func (e *Enemy) update() error {
-	e.prevPos = e.pos.Clone()
-
-	switch e.state {
-	case EnemyStateWaiting:
-		home := mathutil.NewVector2D(enemyHomeX, enemyHomeY)
-		e.pos = e.pos.Add(home.Sub(e.pos).Div(60))
-
-		if e.ticks == e.startNextBulletMLAt {
-			e.game.setBulletML(e.bulletMLIndex)
-			e.state = EnemyStateRunning
-		}
-	case EnemyStateRunning:
-		if err := e.runner.Update(); err != nil {
-			return err
-		}
-		e.pos.X, e.pos.Y = e.runner.Position()
-
-		if e.hit {
-			e.life -= 0.5
-		}
-
-		if e.life <= 0 {
-			for _, b := range e.game.bullets {
-				f := &FlashEffect{
-					pos:   b.pos.Clone(),
-					r:     10,
-					color: color.Gray{0x70},
-					until: 25,
-				}
-				e.game.flashEffects = append(e.game.flashEffects, f)
-			}
-
-			e.game.score += bulletMLGain
-			if e.game.failuresInBulletMLRunning == 0 {
-				e.game.score += zeroFailureGain
-			} else if e.game.failuresInBulletMLRunning == 1 {
-				e.game.score += oneFailureGain
-			}
-			e.game.failuresInBulletMLRunning = 0
-
-			e.runner = nil
-			e.game.bullets = nil
-			e.bulletMLIndex++
-
-			if e.bulletMLIndex < len(bulletMLs) {
-				e.startNextBulletMLAt = e.ticks + 180
-				e.life = 100
-				e.state = EnemyStateWaiting
-			} else {
-				e.explodeAt = e.ticks + 120
-				e.state = EnemyStateFlashing
-			}
-		}
-	case EnemyStateFlashing:
-		if e.ticks%15 == 0 {
-			f := &FlashEffect{
-				pos:   e.pos.Clone().Add(mathutil.NewVector2D(50*e.game.random.Float64()-25, 50*e.game.random.Float64()-25)),
-				r:     60,
-				color: color.Black,
-				until: 30,
-			}
-			e.game.flashEffects = append(e.game.flashEffects, f)
-		}
-
-		if e.ticks == e.explodeAt {
-			for i := 0; i < 50; i++ {
-				s := 2 + 4*e.game.random.Float64()
-				d := math.Pi * 2 * e.game.random.Float64()
-				f := &EnemyFragment{
-					pos: e.pos.Clone(),
-					v:   mathutil.NewVector2D(s*math.Cos(d), s*math.Sin(d)),
-				}
-				e.game.enemyFragments = append(e.game.enemyFragments, f)
-			}
-
-			e.state = EnemyStateExploded
-		}
-	case EnemyStateExploded:
-	}
-
-	if e.hit {
-		e.hit = false
-	}
-
-	e.ticks++
-
-	return nil
-}
-
-func (e *Enemy) draw(dst *ebiten.Image) {
-	if isIn(e.state, EnemyStateWaiting, EnemyStateRunning, EnemyStateFlashing) {
-		opts := &ebiten.DrawImageOptions{}
-		w, h := enemyImg.Size()
-		opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
-		opts.GeoM.Rotate(float64(e.ticks) * math.Pi / 30)
-		opts.GeoM.Translate(e.pos.X, e.pos.Y)
-		dst.DrawImage(enemyImg, opts)
-
-		if e.life > 0 {
-			e.drawLife(dst)
-		}
-	}
-}
-
-func (e *Enemy) drawLife(dst *ebiten.Image) {
-	var path vector.Path
-	const r = 60.0
-
-	path.MoveTo(float32(e.pos.X), float32(e.pos.Y-r))
-	path.Arc(float32(e.pos.X), float32(e.pos.Y), float32(r), -math.Pi/2, float32(-math.Pi/2-2*math.Pi*e.life/100), vector.CounterClockwise)
-
-	op := &vector.StrokeOptions{}
-	op.Width = 5
-	op.LineJoin = vector.LineJoinRound
-	vs, is := path.AppendVerticesAndIndicesForStroke(nil, nil, op)
-
-	for i := range vs {
-		vs[i].SrcX = 1
-		vs[i].SrcY = 1
-		vs[i].ColorR = 0
-		vs[i].ColorG = 0
-		vs[i].ColorB = 0
-		vs[i].ColorA = 0.3
-	}
-
-	opts := &ebiten.DrawTrianglesOptions{}
-	dst.DrawTriangles(vs, is, emptyImg, opts)
-}
-
-type Bullet struct {
-	pos, prevPos *mathutil.Vector2D
-	r            float64
-	hit          bool
-	grazed       bool
-	runner       bulletml.BulletRunner
-	game         *Game
-}
-
-func (b *Bullet) update() error {
-	b.prevPos = b.pos.Clone()
-
-	if err := b.runner.Update(); err != nil {
-		return err
-	}
-
-	b.pos.X, b.pos.Y = b.runner.Position()
-
-	return nil
-}
-
-func (b *Bullet) draw(dst *ebiten.Image) {
-	if b.pos.X-b.r > 0 && b.pos.X+b.r < screenWidth && b.pos.Y-b.r > 0 && b.pos.Y+b.r < screenHeight {
-		opts := &ebiten.DrawImageOptions{}
-		w, h := bulletImg.Size()
-		opts.GeoM.Translate(b.pos.X-float64(w)/2, b.pos.Y-float64(h)/2)
-		dst.DrawImage(bulletImg, opts)
-	}
-}
-
-type Player struct {
-	ticks           int
-	pos, prevPos    *mathutil.Vector2D
-	r               float64
-	grazeR          float64
-	invincibleUntil int
-	hit             bool
-	life            int
-	game            *Game
-}
-
-func (p *Player) invincible() bool {
-	return p.ticks <= p.invincibleUntil
-}
-
-func (p *Player) update() error {
-	p.prevPos = p.pos.Clone()
-
-	if p.hit {
-		p.pos = mathutil.NewVector2D(playerHomeX, playerHomeY)
-		p.invincibleUntil = p.ticks + 60*3
-		p.life--
-		p.game.failuresInBulletMLRunning++
-		p.hit = false
-	}
-
-	if len(p.game.touches) > 0 {
-		t := p.game.touches[0]
-		if prev := t.PreviousPosition(); prev != nil {
-			if diff := t.Position().Sub(prev); diff.NormSq() > 0 {
-				p.pos = p.pos.Add(diff)
-
-				if p.pos.X < 0 {
-					p.pos.X = 0
-				}
-				if p.pos.X > screenWidth {
-					p.pos.X = screenWidth
-				}
-				if p.pos.Y < 0 {
-					p.pos.Y = 0
-				}
-				if p.pos.Y > screenHeight {
-					p.pos.Y = screenHeight
-				}
-			}
-		}
-	}
-
-	if !p.invincible() && p.life > 0 {
-		if p.ticks%5 == 0 {
-			for i := 0; i < 2; i++ {
-				pos := p.pos.Clone()
-				b := &PlayerBullet{
-					pos: pos.Add(mathutil.NewVector2D(float64(10*(i*2-1)), -3)),
-					r:   playerBulletR,
-				}
-				b.prevPos = b.pos
-				p.game.playerBullets = append(p.game.playerBullets, b)
-			}
-		}
-	}
-
-	p.ticks++
-
-	return nil
-}
-
-func (p *Player) draw(dst *ebiten.Image) {
-	if p.life > 0 {
-		opts := &ebiten.DrawImageOptions{}
-		w, h := playerImg.Size()
-		opts.GeoM.Translate(p.pos.X-float64(w)/2, p.pos.Y-float64(h)/2)
-
-		if p.invincible() && p.ticks/10%2 == 0 {
-			opts.ColorScale.ScaleAlpha(0.2)
-		}
-
-		dst.DrawImage(playerImg, opts)
-
-		p.drawLife(dst)
-	}
-}
-
-func (p *Player) drawLife(dst *ebiten.Image) {
-	if p.life > 0 {
-		img := playerLifeImgs[p.life-1]
-
-		opts := &ebiten.DrawImageOptions{}
-		w, h := img.Size()
-		opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
-		opts.GeoM.Rotate(float64(p.ticks) * math.Pi / 30)
-		opts.GeoM.Translate(p.pos.X, p.pos.Y)
-
-		if p.invincible() && p.ticks/10%2 == 0 {
-			opts.ColorScale.ScaleAlpha(0.2)
-		}
-
-		dst.DrawImage(img, opts)
-	}
-}
-
-type PlayerBullet struct {
-	pos, prevPos *mathutil.Vector2D
-	r            float64
-	hit          bool
-}
-
-func (b *PlayerBullet) update() error {
-	b.prevPos = b.pos.Clone()
-
-	b.pos = b.pos.Add(mathutil.NewVector2D(0, -10))
-
-	return nil
-}
-
-func (b *PlayerBullet) draw(dst *ebiten.Image) {
-	if b.pos.X-b.r > 0 && b.pos.X+b.r < screenWidth && b.pos.Y-b.r > 0 && b.pos.Y+b.r < screenHeight {
-		opts := &ebiten.DrawImageOptions{}
-		w, h := playerBulletImg.Size()
-		opts.GeoM.Translate(b.pos.X-float64(w)/2, b.pos.Y-float64(h)/2)
-		opts.ColorScale.ScaleAlpha(0.3)
-		dst.DrawImage(playerBulletImg, opts)
-	}
-}
-
-type FlashEffect struct {
-	ticks    int
-	pos      *mathutil.Vector2D
-	r        float64
-	v        *mathutil.Vector2D
-	color    color.Color
-	until    int
-	finished bool
-}
-
-func (e *FlashEffect) update() error {
-	e.ticks++
-
-	if e.v != nil {
-		e.pos = e.pos.Add(e.v)
-	}
-
-	if e.ticks >= e.until {
-		e.finished = true
-	}
-
-	return nil
-}
-
-func (e *FlashEffect) draw(dst *ebiten.Image) {
-	rad := e.r * float64(e.ticks) / float64(e.until)
-	r, g, b, a := e.color.RGBA()
-	a = uint32(float64(a) * (1 - float64(e.ticks)/float64(e.until)))
-
-	opts := &ebiten.DrawImageOptions{}
-	w, h := flashImg.Size()
-	opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
-	opts.GeoM.Scale(rad*2/float64(w), rad*2/float64(h))
-	opts.GeoM.Translate(e.pos.X, e.pos.Y)
-	opts.ColorScale.Scale(float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff)
-	dst.DrawImage(flashImg, opts)
-}
-
-type EnemyFragment struct {
-	ticks int
-	pos   *mathutil.Vector2D
-	v     *mathutil.Vector2D
-}
-
-func (f *EnemyFragment) update() error {
-	f.pos = f.pos.Add(f.v)
-	f.ticks++
-	return nil
-}
-
-func (f *EnemyFragment) draw(dst *ebiten.Image) {
-	opts := &ebiten.DrawImageOptions{}
-	w, h := enemyImg.Size()
-	opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
-	opts.GeoM.Scale(10/float64(w), 10/float64(h))
-	opts.GeoM.Rotate(float64(f.ticks) * math.Pi / 15)
-	opts.GeoM.Translate(f.pos.X, f.pos.Y)
-	dst.DrawImage(enemyImg, opts)
-}
-
 type GameMode int
 
 const (
 	GameModeTitle GameMode = iota
 	GameModePlaying
 	GameModeGameOver
+	GameModeSettings
 )
 
+// Game adapts the simulation to ebiten. It feeds the input of devices or a
+// replay into the simulation and draws it with the menus.
 type Game struct {
-	touches                   []touchutil.Touch
-	random                    *rand.Rand
-	mode                      GameMode
-	ticksFromModeStart        uint64
-	player                    *Player
-	enemy                     *Enemy
-	bullets                   []*Bullet
-	playerBullets             []*PlayerBullet
-	flashEffects              []*FlashEffect
-	enemyFragments            []*EnemyFragment
-	score                     int
-	graze                     int
-	failuresInBulletMLRunning int
+	touches            []touchutil.Touch
+	random             *rand.Rand
+	mode               GameMode
+	ticksFromModeStart uint64
+	sim                *sim.Game
+	effects            *Effects
+	input              *Input
+	frame              sim.InputFrame
+	seed               int64
+	replay             *sim.Replay
+	replays            []savedReplay
+	replayCursor       int
+	reloadedInRun      bool
+	playback           *Playback
+	titleCursor        int
+	settings           *Settings
+	paused             bool
+	difficulty         *sim.Difficulty
+	titleDifficulty    *sim.Difficulty
+	rankLogPath        string
+	scoreRecords       []ScoreRecord
+	barrageWatcher     *barrageWatcher
+	devError           string
+	devErrorTicks      int
 }
 
 func (g *Game) Update() error {
-	g.touches = touchutil.AppendNewTouches(g.touches)
+	g.touches = g.input.tracker.AppendNewTouches(g.touches)
 	for _, t := range g.touches {
 		t.Update()
 	}
 
-	g.ticksFromModeStart++
-
-	switch g.mode {
-	case GameModeTitle:
-		if len(g.touches) > 0 && g.touches[0].IsJustTouched() {
-			g.player.pos = mathutil.NewVector2D(playerHomeX, playerHomeY)
-
-			g.setNextMode(GameModePlaying)
-		}
+	g.input.update(g.touches)
 
-	case GameModePlaying:
-		if !g.player.invincible() {
-			playerTopLeftX := math.Min(g.player.pos.X-g.player.grazeR, g.player.prevPos.X-g.player.grazeR)
-			playerTopLeftY := math.Min(g.player.pos.Y-g.player.grazeR, g.player.prevPos.Y-g.player.grazeR)
-			playerBottomRightX := math.Max(g.player.pos.X+g.player.grazeR, g.player.prevPos.X+g.player.grazeR)
-			playerBottomRightY := math.Max(g.player.pos.Y+g.player.grazeR, g.player.prevPos.Y+g.player.grazeR)
-			for _, b := range g.bullets {
-				bulletTopLeftX := math.Min(b.pos.X-b.r, b.prevPos.X-b.r)
-				bulletTopLeftY := math.Min(b.pos.Y-b.r, b.prevPos.Y-b.r)
-				bulletBottomRightX := math.Max(b.pos.X+b.r, b.prevPos.X+b.r)
-				bulletBottomRightY := math.Max(b.pos.Y+b.r, b.prevPos.Y+b.r)
-
-				if bulletTopLeftX > playerBottomRightX ||
-					bulletTopLeftY > playerBottomRightY ||
-					bulletBottomRightX < playerTopLeftX ||
-					bulletBottomRightY < playerTopLeftY {
-					continue
-				}
-
-				playerV := g.player.prevPos.Sub(g.player.pos)
-				bulletV := b.prevPos.Sub(b.pos)
-				if mathutil.CapsulesCollide(
-					g.player.pos, playerV, g.player.grazeR,
-					b.pos, bulletV, b.r,
-				) {
-					if !b.grazed {
-						g.graze++
-						g.score += grazeGain
-
-						b.grazed = true
-
-						for i := 0; i < 3; i++ {
-							f := &FlashEffect{
-								pos: b.pos.Add(g.player.pos).Div(2),
-								v: b.pos.Sub(g.player.pos).Add(mathutil.NewVector2D(
-									5*g.random.NormFloat64(),
-									5*g.random.NormFloat64(),
-								)).Normalize().Mul(0.6 + 0.2*g.random.NormFloat64()),
-								r:     3,
-								color: color.RGBA{0x80, 0, 0, 0xff},
-								until: 15,
-							}
-							g.flashEffects = append(g.flashEffects, f)
-						}
-					}
-
-					if mathutil.CapsulesCollide(
-						g.player.pos, playerV, g.player.r,
-						b.pos, bulletV, b.r,
-					) {
-						b.hit = true
-						g.player.hit = true
-
-						_bullets := g.bullets[:0]
-						for _, b := range g.bullets {
-							if b.pos.Sub(mathutil.NewVector2D(playerHomeX, playerHomeY)).NormSq() > 300*300 {
-								_bullets = append(_bullets, b)
-							} else {
-								f := &FlashEffect{
-									pos:   b.pos.Clone(),
-									r:     10,
-									color: color.Gray{0x70},
-									until: 25,
-								}
-								g.flashEffects = append(g.flashEffects, f)
-							}
-						}
-						g.bullets = _bullets
-
-						break
-					}
-				}
-			}
-
-			if mathutil.CapsulesCollide(
-				g.player.pos, g.player.prevPos.Sub(g.player.pos), g.player.r,
-				g.enemy.pos, g.enemy.prevPos.Sub(g.enemy.pos), g.enemy.r,
-			) {
-				g.player.hit = true
-			}
-
-			if g.player.hit {
-				g.touches = nil
+	g.ticksFromModeStart++
 
-				f := &FlashEffect{
-					pos:   g.player.pos.Clone(),
-					r:     40,
-					color: color.RGBA{0xff, 0, 0, 0xff},
-					until: 25,
-				}
-				g.flashEffects = append(g.flashEffects, f)
-			}
+	if g.devErrorTicks > 0 {
+		g.devErrorTicks--
+		if g.devErrorTicks == 0 {
+			g.devError = ""
 		}
+	}
 
-		for _, b := range g.playerBullets {
-			if mathutil.CapsulesCollide(
-				g.enemy.pos, g.enemy.prevPos.Sub(g.enemy.pos), g.enemy.r,
-				b.pos, b.prevPos.Sub(b.pos), b.r,
-			) {
-				b.hit = true
-				g.enemy.hit = true
-
-				f := &FlashEffect{
-					pos:   b.pos.Clone().Add(mathutil.NewVector2D(10*g.random.Float64()-5, 10*g.random.Float64()-5)),
-					r:     10,
-					color: color.Gray{0x70},
-					until: 25,
-				}
-				g.flashEffects = append(g.flashEffects, f)
-			}
+	if g.barrageWatcher != nil {
+		for _, p := range g.barrageWatcher.update() {
+			g.reloadFile(p)
 		}
+	}
 
-		if err := g.player.update(); err != nil {
-			return err
+	switch g.mode {
+	case GameModeTitle:
+		if g.input.justPressed[ActionUp] && g.titleCursor > 0 {
+			g.titleCursor--
 		}
-
-		if err := g.enemy.update(); err != nil {
-			return err
+		if g.input.justPressed[ActionDown] && g.titleCursor < titleRowReplay {
+			g.titleCursor++
 		}
-
-		for i, n := 0, len(g.bullets); i < n; i++ {
-			if err := g.bullets[i].update(); err != nil {
-				return err
+		if g.titleCursor == titleRowReplay && len(g.replays) > 0 {
+			if g.input.justPressed[ActionLeft] {
+				g.replayCursor = (g.replayCursor + len(g.replays) - 1) % len(g.replays)
 			}
-		}
-
-		for i, n := 0, len(g.playerBullets); i < n; i++ {
-			if err := g.playerBullets[i].update(); err != nil {
-				return err
+			if g.input.justPressed[ActionRight] {
+				g.replayCursor = (g.replayCursor + 1) % len(g.replays)
 			}
 		}
-
-		for _, e := range g.flashEffects {
-			if err := e.update(); err != nil {
-				return err
-			}
+		if g.titleCursor < titleRowSettings && sim.Difficulties[g.titleCursor] != g.difficulty {
+			g.setDifficulty(sim.Difficulties[g.titleCursor])
 		}
 
-		for _, f := range g.enemyFragments {
-			if err := f.update(); err != nil {
-				return err
+		if g.input.justPressed[ActionConfirm] {
+			if g.input.tap != nil {
+				if row := titleRowAt(g.input.tap); row >= 0 {
+					g.titleCursor = row
+					if row < titleRowSettings {
+						g.setDifficulty(sim.Difficulties[row])
+					}
+				}
 			}
-		}
 
-		_bullets := g.bullets[:0]
-		for _, b := range g.bullets {
-			if !b.hit &&
-				!b.runner.Vanished() &&
-				b.prevPos.X+b.r > 0 && b.prevPos.X-b.r < screenWidth && b.prevPos.Y+b.r > 0 && b.prevPos.Y-b.r < screenHeight {
-				_bullets = append(_bullets, b)
+			switch g.titleCursor {
+			case titleRowSettings:
+				g.settings = &Settings{}
+				g.setNextMode(GameModeSettings)
+			case titleRowReplay:
+				if err := g.startSelectedReplay(); err != nil {
+					g.showError(err)
+				}
+			default:
+				g.startPlaying(g.random.Int63())
 			}
 		}
-		g.bullets = _bullets
 
-		_playerBullets := g.playerBullets[:0]
-		for _, b := range g.playerBullets {
-			if !b.hit &&
-				b.prevPos.X+b.r > 0 && b.prevPos.X-b.r < screenWidth && b.prevPos.Y+b.r > 0 && b.prevPos.Y-b.r < screenHeight {
-				_playerBullets = append(_playerBullets, b)
+	case GameModeSettings:
+		g.updateSettings()
+
+	case GameModePlaying:
+		if g.playback != nil {
+			if err := g.updatePlayback(); err != nil {
+				return err
 			}
+			break
 		}
-		g.playerBullets = _playerBullets
 
-		_flashEffects := g.flashEffects[:0]
-		for _, e := range g.flashEffects {
-			if !e.finished {
-				_flashEffects = append(_flashEffects, e)
-			}
+		if g.input.justPressed[ActionPause] {
+			g.paused = !g.paused
 		}
-		g.flashEffects = _flashEffects
 
-		_enemyFragments := g.enemyFragments[:0]
-		for _, f := range g.enemyFragments {
-			if f.pos.Sub(mathutil.NewVector2D(screenWidth/2, screenHeight/2)).NormSq() < 500*500 {
-				_enemyFragments = append(_enemyFragments, f)
+		if g.paused {
+			if g.input.justPressed[ActionCancel] {
+				g.initialize()
 			}
+			break
 		}
-		g.enemyFragments = _enemyFragments
 
-		if g.player.life <= 0 || g.enemy.state == EnemyStateExploded {
-			g.setNextMode(GameModeGameOver)
-		}
+		g.frame = g.input.frame()
 
-	case GameModeGameOver:
-		if err := g.player.update(); err != nil {
+		if err := g.step(); err != nil {
 			return err
 		}
 
-		for i, n := 0, len(g.playerBullets); i < n; i++ {
-			if err := g.playerBullets[i].update(); err != nil {
-				return err
-			}
-		}
-
-		for _, e := range g.flashEffects {
-			if err := e.update(); err != nil {
-				return err
-			}
-		}
-
-		for _, f := range g.enemyFragments {
-			if err := f.update(); err != nil {
-				return err
-			}
-		}
+		g.replay.Record(g.sim, g.frame)
 
-		_playerBullets := g.playerBullets[:0]
-		for _, b := range g.playerBullets {
-			if !b.hit &&
-				b.prevPos.X+b.r > 0 && b.prevPos.X-b.r < screenWidth && b.prevPos.Y+b.r > 0 && b.prevPos.Y-b.r < screenHeight {
-				_playerBullets = append(_playerBullets, b)
-			}
+		if g.mode == GameModeGameOver {
+			g.finishRun()
 		}
-		g.playerBullets = _playerBullets
 
-		_flashEffects := g.flashEffects[:0]
-		for _, e := range g.flashEffects {
-			if !e.finished {
-				_flashEffects = append(_flashEffects, e)
-			}
-		}
-		g.flashEffects = _flashEffects
+	case GameModeGameOver:
+		// A replay may end before the play is over.
+		if g.sim.Over() {
+			g.frame = g.input.frame()
 
-		_enemyFragments := g.enemyFragments[:0]
-		for _, f := range g.enemyFragments {
-			if f.pos.Sub(mathutil.NewVector2D(screenWidth/2, screenHeight/2)).NormSq() < 500*500 {
-				_enemyFragments = append(_enemyFragments, f)
+			if err := g.step(); err != nil {
+				return err
 			}
 		}
-		g.enemyFragments = _enemyFragments
 
-		if g.ticksFromModeStart > 120 && len(g.touches) > 0 && g.touches[0].IsJustTouched() {
+		if g.ticksFromModeStart > 120 && g.input.justPressed[ActionConfirm] {
 			g.initialize()
 		}
 	}
@@ -767,15 +218,79 @@ func (g *Game) Update() error {
 	return nil
 }
 
+// step advances the simulation by a tick with g.frame as the input.
+func (g *Game) step() error {
+	if err := g.sim.Step(g.frame); err != nil {
+		if g.abortRun(err) {
+			return nil
+		}
+		return err
+	}
+	g.effects.update(g.sim)
+
+	if g.mode == GameModePlaying && g.sim.Over() {
+		g.setNextMode(GameModeGameOver)
+	}
+
+	return nil
+}
+
+// finishRun records the result and the replay of the run played live.
+func (g *Game) finishRun() {
+	g.scoreRecords = append(g.scoreRecords, ScoreRecord{
+		Score:       g.sim.Score,
+		Graze:       g.sim.Graze,
+		Difficulty:  g.difficulty,
+		RankHistory: g.sim.Rank.History,
+	})
+
+	if err := g.saveScoreRecords(); err != nil {
+		g.showError(err)
+	}
+
+	// The run does not reproduce on any stage if a barrage was reloaded.
+	if !g.reloadedInRun {
+		if err := g.saveReplay(); err != nil {
+			g.showError(err)
+		}
+	}
+
+	if g.rankLogPath != "" {
+		if err := sim.WriteRankHistory(g.rankLogPath, g.sim.Rank.History); err != nil {
+			g.showError(err)
+		}
+	}
+}
+
 func (g *Game) drawTitleText(screen *ebiten.Image) {
 	titleTexts := []string{"BULLET HELL"}
 	for i, s := range titleTexts {
 		text.Draw(screen, s, fontL.Face, screenWidth/2-len(s)*int(fontL.FaceOptions.Size)/2, 85+i*int(fontL.FaceOptions.Size*1.8), color.Black)
 	}
 
-	usageTexts := []string{"[DRAG] Move"}
+	for i := 0; i <= titleRowReplay; i++ {
+		var s string
+		switch {
+		case i == titleRowSettings:
+			s = "SETTINGS"
+		case i == titleRowReplay:
+			s = g.replayText()
+		default:
+			s = sim.Difficulties[i].Name
+		}
+		if i == g.titleCursor {
+			s = fmt.Sprintf("> %s <", s)
+		}
+		text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, difficultyTextY+i*difficultyTextSpacing, color.Black)
+	}
+
+	usageTexts := []string{
+		"[DRAG/ARROWS] Move",
+		fmt.Sprintf("[%s] Focus", g.keyName(ActionFocus)),
+		fmt.Sprintf("[%s/2ND FINGER] Bomb", g.keyName(ActionBomb)),
+	}
 	for i, s := range usageTexts {
-		text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 280+i*int(fontS.FaceOptions.Size*1.8), color.Black)
+		text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 310+i*int(fontS.FaceOptions.Size*1.8), color.Black)
 	}
 
 	creditTexts := []string{"CREATOR: NAOKI TSUJIO", "FONT: Press Start 2P by CodeMan38", "SOUND EFFECT: MaouDamashii", "POWERED BY Ebitengine"}
@@ -786,7 +301,7 @@ func (g *Game) drawTitleText(screen *ebiten.Image) {
 
 func (g *Game) drawGameOverText(screen *ebiten.Image) {
 	var gameOverTexts []string
-	if g.enemy.state == EnemyStateExploded {
+	if g.sim.Cleared() {
 		gameOverTexts = []string{"GAME CLEAR"}
 	} else {
 		gameOverTexts = []string{"GAME OVER"}
@@ -795,16 +310,32 @@ func (g *Game) drawGameOverText(screen *ebiten.Image) {
 		text.Draw(screen, s, fontL.Face, screenWidth/2-len(s)*int(fontL.FaceOptions.Size)/2, 170+i*int(fontL.FaceOptions.Size*1.8), color.Black)
 	}
 
-	scoreText := []string{"YOUR SCORE IS", fmt.Sprintf("%s!", commaInt(g.score))}
+	scoreText := []string{"YOUR SCORE IS", fmt.Sprintf("%s!", commaInt(g.sim.Score))}
 	for i, s := range scoreText {
 		text.Draw(screen, s, fontM.Face, screenWidth/2-len(s)*int(fontM.FaceOptions.Size)/2, 230+i*int(fontM.FaceOptions.Size*1.8), color.Black)
 	}
+
+	if best, found := g.bestScore(g.difficulty); found {
+		s := fmt.Sprintf("%s BEST %s", g.difficulty.Name, commaInt(best.Score))
+		text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 300, color.Black)
+	}
+}
+
+func (g *Game) drawPauseText(screen *ebiten.Image) {
+	s := "PAUSE"
+	text.Draw(screen, s, fontL.Face, screenWidth/2-len(s)*int(fontL.FaceOptions.Size)/2, 200, color.Black)
+
+	s = fmt.Sprintf("[%s] Title", g.keyName(ActionCancel))
+	text.Draw(screen, s, fontS.Face, screenWidth/2-len(s)*int(fontS.FaceOptions.Size)/2, 250, color.Black)
 }
 
 func (g *Game) drawTopMenu(screen *ebiten.Image) {
 	text.Draw(screen, fmt.Sprintf("%.1ffps", ebiten.ActualFPS()), fontSS.Face, 5, 15, color.Gray{0x70})
+	text.Draw(screen, fmt.Sprintf("RANK %.2f", g.sim.Rank.Value), fontSS.Face, 5, 30, color.Gray{0x70})
+
+	boss := g.sim.Boss
 
-	for i := 0; i < len(bulletMLs)-g.enemy.bulletMLIndex; i++ {
+	for i := 0; i < boss.BarragesLeft(); i++ {
 		opts := &ebiten.DrawImageOptions{}
 		w, h := enemyImg.Size()
 		opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
@@ -814,113 +345,117 @@ func (g *Game) drawTopMenu(screen *ebiten.Image) {
 		screen.DrawImage(enemyImg, opts)
 	}
 
-	scoreText := fmt.Sprintf("SCORE %s", commaInt(g.score))
+	if boss.State == sim.EnemyStateRunning {
+		title := boss.Barrage().Title
+		text.Draw(screen, title, fontSS.Face, screenWidth/2-len(title)*8/2, 15, color.Gray{0x70})
+	}
+
+	if t := boss.TimeLeft(); t >= 0 {
+		timeText := fmt.Sprintf("%02d", (t+59)/60)
+		clr := color.Gray{0x70}
+		if t < 60*10 {
+			clr = color.Gray{0}
+		}
+		text.Draw(screen, timeText, fontS.Face, screenWidth/2-len(timeText)*int(fontS.FaceOptions.Size)/2, 35, clr)
+	}
+
+	scoreText := fmt.Sprintf("SCORE %s", commaInt(g.sim.Score))
 	text.Draw(screen, scoreText, fontSS.Face, screenWidth-5-len(scoreText)*8, 15, color.Gray{0x70})
-}
 
-func (g *Game) Draw(screen *ebiten.Image) {
-	screen.Fill(color.White)
+	text.Draw(screen, g.difficulty.Name, fontSS.Face, screenWidth-5-len(g.difficulty.Name)*8, 30, color.Gray{0x70})
 
-	switch g.mode {
-	case GameModeTitle:
-		g.player.draw(screen)
+	powerText := fmt.Sprintf("POWER %d", sim.ShotLevelIndex(g.sim.Player.Power))
+	if g.sim.Player.Power >= sim.MaxPlayerPower {
+		powerText = "POWER MAX"
+	}
+	text.Draw(screen, powerText, fontSS.Face, screenWidth-5-len(powerText)*8, 45, color.Gray{0x70})
 
-		g.enemy.draw(screen)
+	bombText := fmt.Sprintf("BOMB %d", g.sim.Player.Bombs)
+	text.Draw(screen, bombText, fontSS.Face, screenWidth-5-len(bombText)*8, 60, color.Gray{0x70})
+}
 
-		g.drawTitleText(screen)
-	case GameModePlaying:
-		g.player.draw(screen)
+// showError shows the error for devErrorDisplayTicks ticks, while the errors
+// of the files reloaded in the development mode stay until they are fixed.
+func (g *Game) showError(err error) {
+	g.devError = err.Error()
+	g.devErrorTicks = devErrorDisplayTicks
+}
 
-		for _, b := range g.bullets {
-			b.draw(screen)
+// devErrorText returns the error of the game followed by the errors of the
+// files reloaded in the development mode.
+func (g *Game) devErrorText() string {
+	var errs []string
+	if g.devError != "" {
+		errs = append(errs, g.devError)
+	}
+	if g.barrageWatcher != nil {
+		if s := g.barrageWatcher.errorText(); s != "" {
+			errs = append(errs, s)
 		}
+	}
+	return strings.Join(errs, "\n")
+}
 
-		g.enemy.draw(screen)
+func (g *Game) drawDevError(screen *ebiten.Image) {
+	const lineLen = (screenWidth - 10) / 8
 
-		for _, b := range g.playerBullets {
-			b.draw(screen)
+	var lines []string
+	for _, l := range strings.Split(g.devErrorText(), "\n") {
+		for len(l) > lineLen {
+			lines = append(lines, l[:lineLen])
+			l = l[lineLen:]
 		}
+		lines = append(lines, l)
+	}
 
-		for _, e := range g.flashEffects {
-			e.draw(screen)
-		}
+	for i, l := range lines {
+		text.Draw(screen, l, fontSS.Face, 5, screenHeight-5-(len(lines)-1-i)*12, color.RGBA{0xff, 0, 0, 0xff})
+	}
+}
 
-		for _, f := range g.enemyFragments {
-			f.draw(screen)
-		}
+func (g *Game) Draw(screen *ebiten.Image) {
+	screen.Fill(color.White)
 
-		g.drawTopMenu(screen)
-	case GameModeGameOver:
-		g.player.draw(screen)
+	switch g.mode {
+	case GameModeTitle:
+		drawPlayer(screen, g.sim.Player)
 
-		for _, b := range g.bullets {
-			b.draw(screen)
-		}
+		drawEnemy(screen, g.sim.Boss, true)
 
-		g.enemy.draw(screen)
+		g.drawTitleText(screen)
+	case GameModeSettings:
+		g.drawSettings(screen)
+	case GameModePlaying:
+		drawPlay(screen, g.sim, g.effects)
 
-		for _, b := range g.playerBullets {
-			b.draw(screen)
+		if g.paused {
+			g.drawPauseText(screen)
 		}
 
-		for _, e := range g.flashEffects {
-			e.draw(screen)
-		}
+		g.drawTopMenu(screen)
 
-		for _, f := range g.enemyFragments {
-			f.draw(screen)
+		if g.playback != nil {
+			g.drawPlaybackHUD(screen)
 		}
+	case GameModeGameOver:
+		drawPlay(screen, g.sim, g.effects)
 
 		g.drawGameOverText(screen)
 
 		g.drawTopMenu(screen)
-	}
-}
-
-func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
-}
-
-func (g *Game) setBulletML(index int) error {
-	bml := bulletMLs[index]
-
-	enemyRunner := true
-	opts := &bulletml.NewRunnerOptions{
-		OnBulletFired: func(br bulletml.BulletRunner, fc *bulletml.FireContext) {
-			if enemyRunner {
-				g.enemy.runner = br
-				g.enemy.pos.X, g.enemy.pos.Y = br.Position()
-				enemyRunner = false
-			} else {
-				x, y := br.Position()
-				b := &Bullet{
-					pos:     mathutil.NewVector2D(x, y),
-					prevPos: mathutil.NewVector2D(x, y),
-					r:       bulletR,
-					runner:  br,
-					game:    g,
-				}
-				g.bullets = append(g.bullets, b)
-			}
-		},
-		CurrentShootPosition: func() (float64, float64) {
-			return g.enemy.pos.X, g.enemy.pos.Y
-		},
-		CurrentTargetPosition: func() (float64, float64) {
-			return g.player.pos.X, g.player.pos.Y
-		},
-	}
 
-	runner, err := bulletml.NewRunner(bml, opts)
-	if err != nil {
-		return err
+		if g.playback != nil {
+			g.drawPlaybackHUD(screen)
+		}
 	}
 
-	if err := runner.Update(); err != nil {
-		return err
+	if g.devErrorText() != "" {
+		g.drawDevError(screen)
 	}
+}
 
-	return nil
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return screenWidth, screenHeight
 }
 
 func commaInt(v int) string {
@@ -937,47 +472,62 @@ func commaInt(v int) string {
 	return string(r)
 }
 
+// startPlaying starts a run of the simulation seeded with seed, which is
+// recorded in replay with the input frames to reproduce the run.
+func (g *Game) startPlaying(seed int64) {
+	g.seed = seed
+	g.sim = sim.NewGame(stage, g.difficulty, seed)
+	g.effects = newEffects()
+	g.sim.OnMiss = func() {
+		g.clearTouches()
+	}
+
+	g.replay = &sim.Replay{
+		Seed:       g.seed,
+		Difficulty: g.difficulty.Name,
+		StageHash:  stage.Hash,
+	}
+	g.frame = sim.InputFrame{}
+	g.reloadedInRun = false
+
+	g.setNextMode(GameModePlaying)
+}
+
+// clearTouches drops the touches. Held directions start new touches of the
+// keyboard and gamepads in the next tick.
+func (g *Game) clearTouches() {
+	g.touches = nil
+	g.input.tracker.Reset()
+}
+
 func (g *Game) setNextMode(mode GameMode) {
 	g.mode = mode
 	g.ticksFromModeStart = 0
 }
 
+// initialize returns to the title screen. The difficulty of a replay played
+// back is replaced with the one selected before the playback.
 func (g *Game) initialize() {
-	g.touches = nil
+	if g.playback != nil {
+		g.difficulty = g.titleDifficulty
+	}
 
-	playerPos := mathutil.NewVector2D(playerHomeX, playerHomeY-45)
-	g.player = &Player{
-		pos:             playerPos,
-		prevPos:         playerPos,
-		r:               playerR,
-		grazeR:          playerGrazeR,
-		life:            playerInitialLife,
-		invincibleUntil: -1,
-		game:            g,
-	}
-
-	enemyPos := mathutil.NewVector2D(enemyHomeX, enemyHomeY+80)
-	g.enemy = &Enemy{
-		pos:                 enemyPos,
-		prevPos:             enemyPos,
-		r:                   enemyR,
-		state:               EnemyStateWaiting,
-		life:                100,
-		startNextBulletMLAt: 180,
-		game:                g,
-	}
-
-	g.bullets = nil
-	g.playerBullets = nil
-	g.flashEffects = nil
-	g.enemyFragments = nil
-	g.graze = 0
-	g.failuresInBulletMLRunning = 0
-	g.score = 0
+	g.clearTouches()
+	g.sim = newTitleSim(g.difficulty)
+	g.paused = false
+	g.playback = nil
 
 	g.setNextMode(GameModeTitle)
 }
 
+// newTitleSim returns the simulation shown on the title screen, where the
+// player waits above its home.
+func newTitleSim(d *sim.Difficulty) *sim.Game {
+	s := sim.NewGame(stage, d, 0)
+	s.Player.Pos = mathutil.NewVector2D(sim.PlayerHomeX, sim.PlayerHomeY-45)
+	return s
+}
+
 func main() {
 	var seed int64
 	if s, err := strconv.Atoi(os.Getenv("GAME_RAND_SEED")); err == nil {
@@ -990,7 +540,29 @@ func main() {
 	game := &Game{
 		random:             rand.New(rand.NewSource(seed)),
 		ticksFromModeStart: 0,
+		difficulty:         sim.Difficulties[1],
+		rankLogPath:        os.Getenv("GAME_RANK_LOG"),
+		input:              newInput(touchutil.EbitenSource{}),
+		titleCursor:        1,
+	}
+
+	if err := game.input.loadBindings(); err != nil {
+		game.showError(err)
+	}
+
+	if err := game.loadScoreRecords(); err != nil {
+		game.showError(err)
 	}
+
+	if err := game.loadReplayIndex(); err != nil {
+		game.showError(err)
+	}
+
+	if dir := os.Getenv("GAME_BARRAGE_DIR"); dir != "" {
+		game.barrageWatcher = newBarrageWatcher(os.DirFS(dir))
+		game.reloadStage()
+	}
+
 	game.initialize()
 
 	if err := ebiten.RunGame(game); err != nil {
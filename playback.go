@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/tsujio/game-bullet-hell/sim"
+)
+
+const (
+	playbackSeekTicks = 60 * 10
+	playbackBarY      = screenHeight - 6
+)
+
+var playbackSpeeds = []int{1, 2, 4, 8}
+
+// Playback feeds the frames of a replay into the play in place of the live
+// input. It runs several ticks per update to fast-forward, and seeks by
+// replaying the frames from the start. desync is the first mismatch of the
+// state hashes found.
+type Playback struct {
+	replay *sim.Replay
+	tick   int
+	speed  int
+	paused bool
+	desync error
+}
+
+// startSelectedReplay plays back the replay selected on the title screen.
+func (g *Game) startSelectedReplay() error {
+	if len(g.replays) == 0 {
+		return errors.New("replay: no replay recorded")
+	}
+
+	data, err := loadData(replaySlotName(g.replays[g.replayCursor].Slot))
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return errors.New("replay: replay file is missing")
+	}
+
+	r, err := sim.DecodeReplay(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	return g.startPlayback(&Playback{replay: r})
+}
+
+func (g *Game) startPlayback(pb *Playback) error {
+	difficulty := sim.DifficultyByName(pb.replay.Difficulty)
+	if difficulty == nil {
+		return fmt.Errorf("replay: unknown difficulty %q", pb.replay.Difficulty)
+	}
+	if pb.replay.StageHash != stage.Hash {
+		return errors.New("replay: recorded on another stage")
+	}
+
+	if g.playback == nil {
+		g.titleDifficulty = g.difficulty
+	}
+	g.initialize()
+	g.difficulty = difficulty
+	g.startPlaying(pb.replay.Seed)
+
+	pb.tick = 0
+	pb.desync = nil
+	g.playback = pb
+
+	return nil
+}
+
+func (g *Game) updatePlayback() error {
+	pb := g.playback
+	in := g.input
+
+	if in.justPressed[ActionCancel] {
+		g.initialize()
+		return nil
+	}
+
+	if in.justPressed[ActionPause] {
+		pb.paused = !pb.paused
+	}
+
+	if in.justPressed[ActionConfirm] {
+		if in.tap != nil && in.tap.Y > playbackBarY-12 {
+			return g.seekPlayback(int(in.tap.X / screenWidth * float64(len(pb.replay.Frames))))
+		}
+		pb.speed = (pb.speed + 1) % len(playbackSpeeds)
+	}
+
+	if in.justPressed[ActionUp] {
+		return g.seekPlayback(pb.tick - playbackSeekTicks)
+	}
+	if in.justPressed[ActionDown] {
+		return g.seekPlayback(pb.tick + playbackSeekTicks)
+	}
+
+	n := playbackSpeeds[pb.speed]
+	if pb.paused {
+		n = 0
+		if in.justPressed[ActionBomb] {
+			n = 1
+		}
+	}
+
+	for i := 0; i < n && g.mode == GameModePlaying; i++ {
+		if err := g.stepPlayback(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Game) stepPlayback() error {
+	pb := g.playback
+	if pb.tick >= len(pb.replay.Frames) {
+		g.setNextMode(GameModeGameOver)
+		return nil
+	}
+
+	g.frame = pb.replay.Frames[pb.tick]
+	pb.tick++
+
+	if err := g.step(); err != nil {
+		return err
+	}
+
+	if err := pb.replay.Check(g.sim, pb.tick); err != nil && pb.desync == nil {
+		pb.desync = err
+	}
+
+	return nil
+}
+
+// seekPlayback restarts the replay and replays it up to the tick.
+func (g *Game) seekPlayback(tick int) error {
+	pb := g.playback
+	if tick < 0 {
+		tick = 0
+	}
+	if tick > len(pb.replay.Frames) {
+		tick = len(pb.replay.Frames)
+	}
+
+	if err := g.startPlayback(pb); err != nil {
+		return err
+	}
+
+	for pb.tick < tick && g.mode == GameModePlaying {
+		if err := g.stepPlayback(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Game) drawPlaybackHUD(screen *ebiten.Image) {
+	pb := g.playback
+
+	s := fmt.Sprintf("REPLAY x%d", playbackSpeeds[pb.speed])
+	if pb.paused {
+		s += " PAUSED"
+	}
+	text.Draw(screen, s, fontSS.Face, 5, 45, color.Gray{0x70})
+
+	s = fmt.Sprintf("REC SCORE %s", commaInt(pb.replay.Score))
+	text.Draw(screen, s, fontSS.Face, 5, 60, color.Gray{0x70})
+
+	if pb.desync != nil {
+		text.Draw(screen, pb.desync.Error(), fontSS.Face, 5, 75, color.RGBA{0xff, 0, 0, 0xff})
+	}
+
+	s = fmt.Sprintf("[%s] SPEED [%s] PAUSE [%s] STEP [%s/%s] SEEK [%s] EXIT",
+		g.keyName(ActionConfirm), g.keyName(ActionPause), g.keyName(ActionBomb),
+		g.keyName(ActionUp), g.keyName(ActionDown), g.keyName(ActionCancel))
+	text.Draw(screen, s, fontSS.Face, 5, playbackBarY-18, color.Gray{0x70})
+	text.Draw(screen, "[TAP THE BAR] SEEK", fontSS.Face, 5, playbackBarY-6, color.Gray{0x70})
+
+	w := float32(screenWidth)
+	if n := len(pb.replay.Frames); n > 0 {
+		w = float32(screenWidth * pb.tick / n)
+	}
+	vector.DrawFilledRect(screen, 0, playbackBarY, screenWidth, 6, color.Gray{0xe0}, false)
+	vector.DrawFilledRect(screen, 0, playbackBarY, w, 6, color.Gray{0x70}, false)
+}
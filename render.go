@@ -0,0 +1,308 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/tsujio/game-bullet-hell/sim"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+var (
+	emptyImg,
+	playerImg,
+	playerBulletImg,
+	enemyImg,
+	itemImg *ebiten.Image
+	playerLifeImgs []*ebiten.Image
+	flashImg       *ebiten.Image
+	bulletImgs     = make(map[string]*ebiten.Image)
+)
+
+var bulletColors = map[string]color.Color{
+	"":       color.Black,
+	"needle": color.RGBA{0x30, 0x30, 0x80, 0xff},
+	"orb":    color.RGBA{0x80, 0x20, 0x20, 0xff},
+	"rice":   color.RGBA{0x20, 0x60, 0x20, 0xff},
+}
+
+var laserColors = map[string]color.Color{
+	"laser": color.RGBA{0x80, 0, 0x40, 0xff},
+	"beam":  color.RGBA{0x40, 0, 0x80, 0xff},
+}
+
+var itemColors = map[sim.ItemKind]color.Color{
+	sim.ItemKindPoint:     color.RGBA{0x40, 0x40, 0x80, 0xff},
+	sim.ItemKindPower:     color.RGBA{0xa0, 0x20, 0x20, 0xff},
+	sim.ItemKindLifePiece: color.RGBA{0xe0, 0x40, 0xa0, 0xff},
+	sim.ItemKindBombPiece: color.RGBA{0x20, 0x80, 0x20, 0xff},
+}
+
+func init() {
+	img := ebiten.NewImage(3, 3)
+	img.Fill(color.White)
+	emptyImg = img.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+
+	playerImg = ebiten.NewImage(sim.PlayerR*2, sim.PlayerR*2)
+	vector.DrawFilledCircle(playerImg, sim.PlayerR, sim.PlayerR, sim.PlayerR, color.RGBA{0xff, 0, 0, 0xff}, true)
+
+	playerBulletImg = ebiten.NewImage(sim.PlayerBulletR*2, sim.PlayerBulletR*2)
+	vector.DrawFilledCircle(playerBulletImg, sim.PlayerBulletR, sim.PlayerBulletR, sim.PlayerBulletR, color.Black, true)
+
+	enemyImg = ebiten.NewImage(sim.EnemyR*2, sim.EnemyR*2)
+	vector.DrawFilledRect(enemyImg, 0, 0, sim.EnemyR*2, sim.EnemyR*2, color.Black, true)
+
+	itemImg = ebiten.NewImage(sim.ItemR*2, sim.ItemR*2)
+	vector.DrawFilledRect(itemImg, 1, 1, sim.ItemR*2-2, sim.ItemR*2-2, color.White, true)
+
+	for life := 1; life <= sim.MaxPlayerLife(); life++ {
+		img = ebiten.NewImage(70, 70)
+		w, _ := img.Size()
+		for i, n := 0, life-1; i < n; i++ {
+			x := float32(float64(w)/2 + (float64(w)/2-2)*math.Cos(math.Pi*2*float64(i)/float64(n)-math.Pi/2))
+			y := float32(float64(w)/2 + (float64(w)/2-2)*math.Sin(math.Pi*2*float64(i)/float64(n)-math.Pi/2))
+			vector.DrawFilledCircle(img, x, y, 2, color.RGBA{0, 0, 0, 0x70}, true)
+		}
+		playerLifeImgs = append(playerLifeImgs, img)
+	}
+
+	flashImg = ebiten.NewImage(500, 500)
+	vector.DrawFilledCircle(flashImg, 250, 250, 250, color.White, true)
+
+	img = ebiten.NewImage(sim.BulletR*2, sim.BulletR*2)
+	vector.DrawFilledCircle(img, sim.BulletR, sim.BulletR, sim.BulletR, color.White, true)
+	bulletImgs[""] = img
+
+	img = ebiten.NewImage(4, 16)
+	vector.DrawFilledRect(img, 1, 0, 2, 16, color.White, true)
+	bulletImgs["needle"] = img
+
+	img = ebiten.NewImage(24, 24)
+	vector.DrawFilledCircle(img, 12, 12, 12, color.White, true)
+	vector.DrawFilledCircle(img, 12, 12, 8, color.RGBA{0x80, 0x80, 0x80, 0x80}, true)
+	bulletImgs["orb"] = img
+
+	img = ebiten.NewImage(6, 10)
+	vector.DrawFilledCircle(img, 3, 3, 3, color.White, true)
+	vector.DrawFilledCircle(img, 3, 7, 3, color.White, true)
+	bulletImgs["rice"] = img
+}
+
+// drawPlay draws the entities of the play and the effects.
+func drawPlay(dst *ebiten.Image, s *sim.Game, ef *Effects) {
+	drawPlayer(dst, s.Player)
+
+	for _, l := range s.Lasers {
+		drawLaser(dst, l)
+	}
+
+	for _, b := range s.Bullets {
+		drawBullet(dst, b)
+	}
+
+	for _, i := range s.Items {
+		drawItem(dst, i)
+	}
+
+	for _, b := range s.Bombs {
+		drawBomb(dst, b)
+	}
+
+	for _, e := range s.Enemies {
+		drawEnemy(dst, e, e == s.Boss)
+	}
+
+	for _, b := range s.PlayerBullets {
+		drawPlayerBullet(dst, b)
+	}
+
+	for _, f := range ef.flashes {
+		drawFlashEffect(dst, f)
+	}
+
+	for _, f := range ef.fragments {
+		drawEnemyFragment(dst, f)
+	}
+}
+
+// drawEnemy draws the enemy, with the life gauge if it is the boss.
+func drawEnemy(dst *ebiten.Image, e *sim.Enemy, boss bool) {
+	if e.Alive() {
+		opts := &ebiten.DrawImageOptions{}
+		w, h := enemyImg.Size()
+		opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+		opts.GeoM.Scale(e.R/sim.EnemyR, e.R/sim.EnemyR)
+		opts.GeoM.Rotate(float64(e.Ticks) * math.Pi / 30)
+		opts.GeoM.Translate(e.Pos.X, e.Pos.Y)
+		dst.DrawImage(enemyImg, opts)
+
+		if e.Life > 0 && boss && !e.Barrage().Survival {
+			drawEnemyLife(dst, e)
+		}
+	}
+}
+
+func drawEnemyLife(dst *ebiten.Image, e *sim.Enemy) {
+	var path vector.Path
+	const r = 60.0
+
+	path.MoveTo(float32(e.Pos.X), float32(e.Pos.Y-r))
+	path.Arc(float32(e.Pos.X), float32(e.Pos.Y), float32(r), -math.Pi/2, float32(-math.Pi/2-2*math.Pi*e.Life/e.MaxLife), vector.CounterClockwise)
+
+	op := &vector.StrokeOptions{}
+	op.Width = 5
+	op.LineJoin = vector.LineJoinRound
+	vs, is := path.AppendVerticesAndIndicesForStroke(nil, nil, op)
+
+	for i := range vs {
+		vs[i].SrcX = 1
+		vs[i].SrcY = 1
+		vs[i].ColorR = 0
+		vs[i].ColorG = 0
+		vs[i].ColorB = 0
+		vs[i].ColorA = 0.3
+	}
+
+	opts := &ebiten.DrawTrianglesOptions{}
+	dst.DrawTriangles(vs, is, emptyImg, opts)
+}
+
+func drawBullet(dst *ebiten.Image, b *sim.Bullet) {
+	if b.OnScreen() {
+		img := bulletImgs[b.Kind.Name]
+		opts := &ebiten.DrawImageOptions{}
+		w, h := img.Size()
+		opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+		if b.Kind.Rotates {
+			opts.GeoM.Rotate(b.Dir - math.Pi/2)
+		}
+		opts.GeoM.Translate(b.Pos.X, b.Pos.Y)
+		r, g, bl, a := bulletColors[b.Kind.Name].RGBA()
+		opts.ColorScale.Scale(float32(r)/0xffff, float32(g)/0xffff, float32(bl)/0xffff, float32(a)/0xffff)
+		dst.DrawImage(img, opts)
+	}
+}
+
+func drawPlayer(dst *ebiten.Image, p *sim.Player) {
+	if p.Life > 0 {
+		opts := &ebiten.DrawImageOptions{}
+		w, h := playerImg.Size()
+		opts.GeoM.Translate(p.Pos.X-float64(w)/2, p.Pos.Y-float64(h)/2)
+
+		if p.Dying() {
+			if p.Ticks/2%2 == 0 {
+				opts.ColorScale.Scale(1, 1, 1, 0.3)
+			}
+			vector.StrokeCircle(dst, float32(p.Pos.X), float32(p.Pos.Y), float32(p.GrazeR*2), 1, color.RGBA{0xff, 0, 0, 0xff}, true)
+		} else if p.Invincible() && p.Ticks/10%2 == 0 {
+			opts.ColorScale.ScaleAlpha(0.2)
+		}
+
+		dst.DrawImage(playerImg, opts)
+
+		if p.Focused {
+			drawPlayerHitbox(dst, p)
+		}
+
+		drawPlayerLife(dst, p)
+	}
+}
+
+func drawPlayerHitbox(dst *ebiten.Image, p *sim.Player) {
+	x, y := float32(p.Pos.X), float32(p.Pos.Y)
+	vector.StrokeCircle(dst, x, y, float32(p.GrazeR), 1, color.RGBA{0, 0, 0, 0x60}, true)
+	vector.DrawFilledCircle(dst, x, y, float32(p.R), color.White, true)
+	vector.StrokeCircle(dst, x, y, float32(p.R), 1, color.RGBA{0xff, 0, 0, 0xff}, true)
+}
+
+func drawPlayerLife(dst *ebiten.Image, p *sim.Player) {
+	if p.Life > 0 {
+		img := playerLifeImgs[p.Life-1]
+
+		opts := &ebiten.DrawImageOptions{}
+		w, h := img.Size()
+		opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+		opts.GeoM.Rotate(float64(p.Ticks) * math.Pi / 30)
+		opts.GeoM.Translate(p.Pos.X, p.Pos.Y)
+
+		if p.Invincible() && p.Ticks/10%2 == 0 {
+			opts.ColorScale.ScaleAlpha(0.2)
+		}
+
+		dst.DrawImage(img, opts)
+	}
+}
+
+func drawPlayerBullet(dst *ebiten.Image, b *sim.PlayerBullet) {
+	if b.Pos.X-b.R > 0 && b.Pos.X+b.R < screenWidth && b.Pos.Y-b.R > 0 && b.Pos.Y+b.R < screenHeight {
+		opts := &ebiten.DrawImageOptions{}
+		w, h := playerBulletImg.Size()
+		opts.GeoM.Translate(b.Pos.X-float64(w)/2, b.Pos.Y-float64(h)/2)
+		opts.ColorScale.ScaleAlpha(0.3)
+		dst.DrawImage(playerBulletImg, opts)
+	}
+}
+
+func drawFlashEffect(dst *ebiten.Image, f *flashEffect) {
+	rad := f.r * float64(f.ticks) / float64(f.until)
+	r, g, b, a := f.color.RGBA()
+	a = uint32(float64(a) * (1 - float64(f.ticks)/float64(f.until)))
+
+	opts := &ebiten.DrawImageOptions{}
+	w, h := flashImg.Size()
+	opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+	opts.GeoM.Scale(rad*2/float64(w), rad*2/float64(h))
+	opts.GeoM.Translate(f.pos.X, f.pos.Y)
+	opts.ColorScale.Scale(float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff)
+	dst.DrawImage(flashImg, opts)
+}
+
+func drawEnemyFragment(dst *ebiten.Image, f *enemyFragment) {
+	opts := &ebiten.DrawImageOptions{}
+	w, h := enemyImg.Size()
+	opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+	opts.GeoM.Scale(10/float64(w), 10/float64(h))
+	opts.GeoM.Rotate(float64(f.ticks) * math.Pi / 15)
+	opts.GeoM.Translate(f.pos.X, f.pos.Y)
+	dst.DrawImage(enemyImg, opts)
+}
+
+func drawBomb(dst *ebiten.Image, b *sim.Bomb) {
+	a := uint8(0x60 * (1 - float64(b.Ticks)/sim.BombDuration))
+	vector.StrokeCircle(dst, float32(b.Pos.X), float32(b.Pos.Y), float32(b.R()), 6, color.RGBA{a, 0, 0, a}, true)
+}
+
+func drawLaser(dst *ebiten.Image, l *sim.Laser) {
+	end := l.Origin.Add(mathutil.NewVector2D(math.Cos(l.Dir), math.Sin(l.Dir)).Mul(l.Kind.Length))
+	clr := laserColors[l.Kind.Name]
+	r, g, b, a := clr.RGBA()
+
+	if l.Ticks < l.Kind.Warning {
+		if l.Ticks/5%2 == 0 {
+			warning := color.RGBA64{uint16(r / 3), uint16(g / 3), uint16(b / 3), uint16(a / 3)}
+			vector.StrokeLine(dst, float32(l.Origin.X), float32(l.Origin.Y), float32(end.X), float32(end.Y), 1, warning, true)
+		}
+		return
+	}
+
+	w := float32(l.Width())
+	vector.StrokeLine(dst, float32(l.Origin.X), float32(l.Origin.Y), float32(end.X), float32(end.Y), w, clr, true)
+	vector.StrokeLine(dst, float32(l.Origin.X), float32(l.Origin.Y), float32(end.X), float32(end.Y), w/3, color.White, true)
+}
+
+func drawItem(dst *ebiten.Image, i *sim.Item) {
+	opts := &ebiten.DrawImageOptions{}
+	w, h := itemImg.Size()
+	opts.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+	if i.Kind != sim.ItemKindPoint {
+		opts.GeoM.Scale(1.5, 1.5)
+	}
+	opts.GeoM.Rotate(float64(i.Ticks) * 0.1)
+	opts.GeoM.Translate(i.Pos.X, i.Pos.Y)
+	r, g, b, a := itemColors[i.Kind].RGBA()
+	opts.ColorScale.Scale(float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff)
+	dst.DrawImage(itemImg, opts)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	replayIndexName = "replays.json"
+	replaySlots     = 10
+)
+
+// savedReplay is an entry of the replay index. The replays are saved in a
+// ring of replaySlots files, and the index lists them from the newest, so the
+// oldest replay is overwritten once all the slots are used.
+type savedReplay struct {
+	Slot       int       `json:"slot"`
+	Time       time.Time `json:"time"`
+	Difficulty string    `json:"difficulty"`
+	Score      int       `json:"score"`
+}
+
+func replaySlotName(slot int) string {
+	return fmt.Sprintf("replay-%d.replay", slot)
+}
+
+// loadReplayIndex reads the index of the saved replays. Entries of slots out
+// of the ring are skipped.
+func (g *Game) loadReplayIndex() error {
+	data, err := loadData(replayIndexName)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var saved []savedReplay
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	g.replays = saved[:0]
+	for _, r := range saved {
+		if r.Slot >= 0 && r.Slot < replaySlots && len(g.replays) < replaySlots {
+			g.replays = append(g.replays, r)
+		}
+	}
+
+	return nil
+}
+
+// saveReplay writes the replay of the finished run into the slot of the
+// oldest replay, or an unused one, and puts it at the head of the index.
+func (g *Game) saveReplay() error {
+	g.replay.Score = g.sim.Score
+
+	data, err := g.replay.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	replays := g.replays
+	var slot int
+	if len(replays) >= replaySlots {
+		slot = replays[len(replays)-1].Slot
+		replays = replays[:len(replays)-1]
+	} else {
+		used := make(map[int]bool)
+		for _, r := range g.replays {
+			used[r.Slot] = true
+		}
+		for used[slot] {
+			slot++
+		}
+	}
+
+	if err := saveData(replaySlotName(slot), data); err != nil {
+		return err
+	}
+
+	g.replays = append([]savedReplay{{
+		Slot:       slot,
+		Time:       time.Now(),
+		Difficulty: g.replay.Difficulty,
+		Score:      g.replay.Score,
+	}}, replays...)
+	g.replayCursor = 0
+
+	index, err := json.Marshal(g.replays)
+	if err != nil {
+		return err
+	}
+
+	return saveData(replayIndexName, index)
+}
+
+// replayText returns the title screen row of the selected replay.
+func (g *Game) replayText() string {
+	if len(g.replays) == 0 {
+		return "REPLAY -"
+	}
+
+	r := g.replays[g.replayCursor]
+	return fmt.Sprintf("REPLAY %d/%d %s %s %s", g.replayCursor+1, len(g.replays), r.Time.Format("01-02 15:04"), r.Difficulty, commaInt(r.Score))
+}
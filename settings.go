@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+const (
+	settingsTextY       = 120
+	settingsTextSpacing = 24
+)
+
+// Rows of the settings screen follow the actions.
+const (
+	settingsRowReset = int(actionCount) + iota
+	settingsRowBack
+	settingsRowCount
+)
+
+// Settings is the screen to rebind the keys and gamepad buttons of actions.
+// Confirming an action row waits for a key or a button, which replaces the
+// keys or the buttons bound to the action.
+type Settings struct {
+	cursor  int
+	waiting bool
+}
+
+func settingsRowAt(pos *mathutil.Vector2D) int {
+	for i := 0; i < settingsRowCount; i++ {
+		y := float64(settingsTextY + i*settingsTextSpacing)
+		if pos.Y > y-settingsTextSpacing+4 && pos.Y <= y+4 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Game) updateSettings() {
+	s := g.settings
+	in := g.input
+
+	if s.waiting {
+		if in.tap != nil {
+			s.waiting = false
+			return
+		}
+
+		key, button := in.justPressedDevice()
+		if key == nil && button == nil {
+			return
+		}
+
+		b := in.bindings[Action(s.cursor)]
+		if key != nil {
+			b.Keys = []ebiten.Key{*key}
+		} else {
+			b.GamepadButtons = []ebiten.StandardGamepadButton{*button}
+		}
+		in.setBindings(in.bindings)
+		s.waiting = false
+
+		if err := in.saveBindings(); err != nil {
+			g.showError(err)
+		}
+		return
+	}
+
+	if in.justPressed[ActionUp] {
+		s.cursor = (s.cursor + settingsRowCount - 1) % settingsRowCount
+	}
+	if in.justPressed[ActionDown] {
+		s.cursor = (s.cursor + 1) % settingsRowCount
+	}
+
+	if in.justPressed[ActionCancel] {
+		g.setNextMode(GameModeTitle)
+		return
+	}
+
+	if !in.justPressed[ActionConfirm] {
+		return
+	}
+
+	if in.tap != nil {
+		row := settingsRowAt(in.tap)
+		if row < 0 {
+			return
+		}
+		s.cursor = row
+	}
+
+	switch s.cursor {
+	case settingsRowReset:
+		in.setBindings(defaultBindings())
+		if err := in.saveBindings(); err != nil {
+			g.showError(err)
+		}
+	case settingsRowBack:
+		g.setNextMode(GameModeTitle)
+	default:
+		s.waiting = true
+	}
+}
+
+func (g *Game) drawSettings(screen *ebiten.Image) {
+	title := "SETTINGS"
+	text.Draw(screen, title, fontM.Face, screenWidth/2-len(title)*int(fontM.FaceOptions.Size)/2, 70, color.Black)
+
+	for i := 0; i < settingsRowCount; i++ {
+		var s string
+		switch i {
+		case settingsRowReset:
+			s = "RESET"
+		case settingsRowBack:
+			s = "BACK"
+		default:
+			s = g.bindingText(Action(i))
+		}
+
+		clr := color.Gray{0x70}
+		if i == g.settings.cursor {
+			clr = color.Gray{0}
+			if g.settings.waiting {
+				s = fmt.Sprintf("%-8s PRESS A KEY OR BUTTON", strings.ToUpper(actionNames[Action(i)]))
+			}
+			s = "> " + s
+		} else {
+			s = "  " + s
+		}
+
+		text.Draw(screen, s, fontS.Face, 40, settingsTextY+i*settingsTextSpacing, clr)
+	}
+}
+
+func (g *Game) bindingText(a Action) string {
+	b := g.input.bindings[a]
+
+	var keys, buttons []string
+	for _, k := range b.Keys {
+		keys = append(keys, strings.ToUpper(k.String()))
+	}
+	for _, btn := range b.GamepadButtons {
+		buttons = append(buttons, gamepadButtonNames[btn])
+	}
+
+	return fmt.Sprintf("%-8s %-12s %s", strings.ToUpper(actionNames[a]), strings.Join(keys, "/"), strings.Join(buttons, "/"))
+}
+
+// keyName returns the name of the first key bound to the action.
+func (g *Game) keyName(a Action) string {
+	if keys := g.input.bindings[a].Keys; len(keys) > 0 {
+		return strings.ToUpper(keys[0].String())
+	}
+	return "-"
+}
@@ -0,0 +1,103 @@
+// Package shapeutil provides hitbox shapes and swept collision tests between
+// a shape and a circle.
+package shapeutil
+
+import (
+	"math"
+
+	"github.com/tsujio/game-util/mathutil"
+)
+
+// Shape is a hitbox in its local frame, where the origin is the center of the
+// object and the +X axis is its facing direction.
+type Shape interface {
+	// Extent returns the radius of the bounding circle of the shape.
+	Extent() float64
+
+	// sweepCircle reports whether a circle of radius r moving from p0 to p1
+	// in the local frame touches the shape.
+	sweepCircle(p0, p1 *mathutil.Vector2D, r float64) bool
+}
+
+// Collide reports whether the shape and a circle touch at any moment in a
+// tick. pos and prevPos are the positions of the shape at the end and the
+// beginning of the tick and angle is its facing direction, and cpos, cprevPos
+// and r are the positions and the radius of the circle. Both objects are
+// assumed to move linearly during the tick, so fast objects never tunnel
+// through each other.
+func Collide(s Shape, pos, prevPos *mathutil.Vector2D, angle float64, cpos, cprevPos *mathutil.Vector2D, r float64) bool {
+	p0 := cprevPos.Sub(prevPos).Rotate(-angle)
+	p1 := cpos.Sub(pos).Rotate(-angle)
+	return s.sweepCircle(p0, p1, r)
+}
+
+// Circle is a circle of radius R.
+type Circle struct {
+	R float64
+}
+
+func (c *Circle) Extent() float64 {
+	return c.R
+}
+
+func (c *Circle) sweepCircle(p0, p1 *mathutil.Vector2D, r float64) bool {
+	d, _, _ := mathutil.PointLineSegmentDistance(mathutil.NewVector2D(0, 0), p0, p1.Sub(p0))
+	return d <= c.R+r
+}
+
+// Ellipse is an ellipse whose semi-axis along the facing direction is A and
+// the other one is B.
+type Ellipse struct {
+	A, B float64
+}
+
+func (e *Ellipse) Extent() float64 {
+	return math.Max(e.A, e.B)
+}
+
+// The ellipse grown by r is approximated by the ellipse with semi-axes A+r
+// and B+r, which is scaled to the unit circle.
+func (e *Ellipse) sweepCircle(p0, p1 *mathutil.Vector2D, r float64) bool {
+	a, b := e.A+r, e.B+r
+	q0 := mathutil.NewVector2D(p0.X/a, p0.Y/b)
+	q1 := mathutil.NewVector2D(p1.X/a, p1.Y/b)
+	d, _, _ := mathutil.PointLineSegmentDistance(mathutil.NewVector2D(0, 0), q0, q1.Sub(q0))
+	return d <= 1
+}
+
+// Capsule is a segment of length 2*L along the facing direction swept by a
+// circle of radius R.
+type Capsule struct {
+	L, R float64
+}
+
+func (c *Capsule) Extent() float64 {
+	return c.L + c.R
+}
+
+func (c *Capsule) sweepCircle(p0, p1 *mathutil.Vector2D, r float64) bool {
+	d := segmentsDistance(
+		mathutil.NewVector2D(-c.L, 0), mathutil.NewVector2D(2*c.L, 0),
+		p0, p1.Sub(p0),
+	)
+	return d <= c.R+r
+}
+
+// segmentsDistance returns the distance between the segment from p1 to p1+v1
+// and the one from p2 to p2+v2.
+func segmentsDistance(p1, v1, p2, v2 *mathutil.Vector2D) float64 {
+	if cross := v1.X*v2.Y - v1.Y*v2.X; cross != 0 {
+		w := p2.Sub(p1)
+		t := (w.X*v2.Y - w.Y*v2.X) / cross
+		u := (w.X*v1.Y - w.Y*v1.X) / cross
+		if 0 <= t && t <= 1 && 0 <= u && u <= 1 {
+			return 0
+		}
+	}
+
+	d1, _, _ := mathutil.PointLineSegmentDistance(p1, p2, v2)
+	d2, _, _ := mathutil.PointLineSegmentDistance(p1.Add(v1), p2, v2)
+	d3, _, _ := mathutil.PointLineSegmentDistance(p2, p1, v1)
+	d4, _, _ := mathutil.PointLineSegmentDistance(p2.Add(v2), p1, v1)
+	return math.Min(math.Min(d1, d2), math.Min(d3, d4))
+}
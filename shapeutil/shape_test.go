@@ -0,0 +1,125 @@
+package shapeutil
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tsujio/game-util/mathutil"
+)
+
+func v(x, y float64) *mathutil.Vector2D {
+	return mathutil.NewVector2D(x, y)
+}
+
+func TestCollide(t *testing.T) {
+	tests := []struct {
+		name           string
+		shape          Shape
+		pos, prevPos   *mathutil.Vector2D
+		angle          float64
+		cpos, cprevPos *mathutil.Vector2D
+		r              float64
+		expected       bool
+	}{
+		{
+			name:  "circle passing through a still circle in a tick",
+			shape: &Circle{R: 3},
+			pos:   v(0, 100), prevPos: v(0, -100),
+			cpos: v(0, 0), cprevPos: v(0, 0), r: 4,
+			expected: true,
+		},
+		{
+			name:  "circle passing by a still circle",
+			shape: &Circle{R: 3},
+			pos:   v(8, 100), prevPos: v(8, -100),
+			cpos: v(0, 0), cprevPos: v(0, 0), r: 4,
+			expected: false,
+		},
+		{
+			name:  "circle moving side by side with a circle",
+			shape: &Circle{R: 3},
+			pos:   v(10, 100), prevPos: v(10, -100),
+			cpos: v(0, 100), cprevPos: v(0, -100), r: 4,
+			expected: false,
+		},
+		{
+			name:  "circle crossing the path of a circle at the same time",
+			shape: &Circle{R: 3},
+			pos:   v(50, 0), prevPos: v(-50, 0),
+			cpos: v(0, 50), cprevPos: v(0, -50), r: 4,
+			expected: true,
+		},
+		{
+			name:  "circle crossing the path of a circle after it has passed",
+			shape: &Circle{R: 3},
+			pos:   v(50, 0), prevPos: v(-50, 0),
+			cpos: v(0, 150), cprevPos: v(0, 50), r: 4,
+			expected: false,
+		},
+		{
+			name:  "ellipse passing through a circle along its major axis",
+			shape: &Ellipse{A: 8, B: 2},
+			pos:   v(200, 2.5), prevPos: v(-200, 2.5),
+			cpos: v(0, 0), cprevPos: v(0, 0), r: 1,
+			expected: true,
+		},
+		{
+			name:  "ellipse passing by a circle beyond its minor axis",
+			shape: &Ellipse{A: 8, B: 2},
+			pos:   v(200, 3.5), prevPos: v(-200, 3.5),
+			cpos: v(0, 0), cprevPos: v(0, 0), r: 1,
+			expected: false,
+		},
+		{
+			name:  "rotated ellipse passing by a circle beyond its minor axis",
+			shape: &Ellipse{A: 8, B: 2},
+			pos:   v(3.5, 200), prevPos: v(3.5, -200),
+			angle: math.Pi / 2,
+			cpos:  v(0, 0), cprevPos: v(0, 0), r: 1,
+			expected: false,
+		},
+		{
+			name:  "ellipse sliding sideways onto a circle at its major axis",
+			shape: &Ellipse{A: 8, B: 2},
+			pos:   v(0, 100), prevPos: v(0, -100),
+			cpos: v(8.5, 0), cprevPos: v(8.5, 0), r: 1,
+			expected: true,
+		},
+		{
+			name:  "capsule passing through a circle along its axis",
+			shape: &Capsule{L: 7, R: 1.5},
+			pos:   v(300, 0), prevPos: v(-300, 0),
+			cpos: v(0, 2), cprevPos: v(0, 2), r: 1,
+			expected: true,
+		},
+		{
+			name:  "capsule passing by a circle",
+			shape: &Capsule{L: 7, R: 1.5},
+			pos:   v(300, 3), prevPos: v(-300, 3),
+			cpos: v(0, 0), cprevPos: v(0, 0), r: 1,
+			expected: false,
+		},
+		{
+			name:  "circle moving across a still capsule",
+			shape: &Capsule{L: 7, R: 1.5},
+			pos:   v(0, 0), prevPos: v(0, 0),
+			cpos: v(5, 100), cprevPos: v(5, -100), r: 1,
+			expected: true,
+		},
+		{
+			name:  "circle moving across beyond the tip of a capsule",
+			shape: &Capsule{L: 7, R: 1.5},
+			pos:   v(0, 0), prevPos: v(0, 0),
+			cpos: v(10, 100), cprevPos: v(10, -100), r: 1,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c := Collide(tt.shape, tt.pos, tt.prevPos, tt.angle, tt.cpos, tt.cprevPos, tt.r); c != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, c)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package sim
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	goldenTicks       = 600
+	goldenInterval    = 60
+	goldenMaxBullets  = 32
+	goldenMaxMismatch = 10
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenCase is a stage made of a single barrage, run by the boss or by a
+// popcorn enemy of a wave.
+type goldenCase struct {
+	name  string
+	stage *Stage
+}
+
+// goldenCases returns a case for every barrage file of the boss and every
+// wave of the stage, named after the barrage file so that the golden files
+// stay with their barrages when the manifest is reordered. Waves sharing a
+// file are told apart by their spawn tick. The barrages start at the first
+// tick.
+func goldenCases(t *testing.T, stage *Stage) []goldenCase {
+	t.Helper()
+
+	var cases []goldenCase
+	names := make(map[string]bool)
+	add := func(name string, stage *Stage) {
+		if names[name] {
+			t.Fatalf("golden case %s is duplicated", name)
+		}
+		names[name] = true
+		cases = append(cases, goldenCase{name: name, stage: stage})
+	}
+
+	// The boss runs a file the same way wherever it is in the manifest.
+	for _, b := range stage.Barrages {
+		name := strings.TrimSuffix(path.Base(b.File), ".xml")
+		if names[name] {
+			continue
+		}
+		bb := *b
+		bb.Delay = 0
+		add(name, &Stage{Barrages: []*Barrage{&bb}})
+	}
+
+	// The boss of a wave case waits until the end of the run.
+	idle := &Barrage{EnemyLife: 1, Delay: goldenTicks + 1}
+	for _, w := range stage.Waves {
+		ww := *w
+		ww.SpawnAt = 0
+		ww.Count = 1
+		name := fmt.Sprintf("%s-at-%d", strings.TrimSuffix(path.Base(w.Barrage.File), ".xml"), w.SpawnAt)
+		add(name, &Stage{Waves: []*Wave{&ww}, Barrages: []*Barrage{idle}})
+	}
+
+	return cases
+}
+
+// runGolden runs the stage with the player standing still at its home as
+// the target, and dumps the bullets and the lasers every goldenInterval
+// ticks. The positions of only the first goldenMaxBullets bullets are
+// dumped, and a checksum of the positions of all of them catches drift in
+// the rest. The player is invincible and does not shoot, so the barrages run
+// undisturbed.
+func runGolden(t *testing.T, stage *Stage) string {
+	t.Helper()
+
+	g := NewGame(stage, Difficulties[1], 1)
+	g.Player.KeepInvincible()
+
+	var b strings.Builder
+	for tick := 1; tick <= goldenTicks; tick++ {
+		if err := g.Step(InputFrame{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if tick%goldenInterval != 0 {
+			continue
+		}
+
+		// The checksum is taken over the rounded positions as dumped, so
+		// that it changes only when a dumped line would.
+		sum := fnv.New64a()
+		for _, bl := range g.Bullets {
+			fmt.Fprintf(sum, "%.3f %.3f\n", bl.Pos.X, bl.Pos.Y)
+		}
+
+		fmt.Fprintf(&b, "tick %d\n", tick)
+		fmt.Fprintf(&b, "bullets %d %016x\n", len(g.Bullets), sum.Sum64())
+		for i, bl := range g.Bullets {
+			if i == goldenMaxBullets {
+				break
+			}
+			fmt.Fprintf(&b, "bullet %.3f %.3f\n", bl.Pos.X, bl.Pos.Y)
+		}
+		for _, l := range g.Lasers {
+			fmt.Fprintf(&b, "laser %.3f %.3f %.4f\n", l.Origin.X, l.Origin.Y, l.Dir)
+		}
+	}
+
+	return b.String()
+}
+
+// diffGolden returns a description of the lines differing between got and
+// want with the ticks they belong to, or "" if they are the same.
+func diffGolden(got, want string) string {
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(want, "\n")
+
+	var b strings.Builder
+	tick := "start"
+	mismatches := 0
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			mismatches++
+			if mismatches <= goldenMaxMismatch {
+				fmt.Fprintf(&b, "%s, line %d:\n\tgot:  %s\n\twant: %s\n", tick, i+1, g, w)
+			}
+		}
+		if strings.HasPrefix(w, "tick ") {
+			tick = w
+		}
+	}
+
+	if mismatches > goldenMaxMismatch {
+		fmt.Fprintf(&b, "... and %d more lines\n", mismatches-goldenMaxMismatch)
+	}
+	if len(gotLines) != len(wantLines) {
+		fmt.Fprintf(&b, "got %d lines, want %d lines\n", len(gotLines), len(wantLines))
+	}
+
+	return b.String()
+}
+
+func TestBarrageGolden(t *testing.T) {
+	for _, c := range goldenCases(t, loadTestStage(t)) {
+		t.Run(c.name, func(t *testing.T) {
+			got := runGolden(t, c.stage)
+			name := filepath.Join("testdata", c.name+".golden")
+
+			if *update {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(name, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+
+			if diff := diffGolden(got, string(want)); diff != "" {
+				t.Errorf("trajectories differ from %s (run with -update if intended):\n%s", name, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package sim
+
+import "github.com/tsujio/game-util/mathutil"
+
+const (
+	playerInitialBombs  = 3
+	BombDuration        = 90
+	bombMaxR            = 400
+	bombInvincibleTicks = 150
+	bombHitInterval     = 6
+)
+
+// Bomb is a shock wave expanding from the player. It clears enemy bullets and
+// lasers within its radius and damages enemies in it every bombHitInterval
+// ticks.
+type Bomb struct {
+	Ticks    int
+	Pos      *mathutil.Vector2D
+	finished bool
+	game     *Game
+}
+
+func (b *Bomb) R() float64 {
+	t := float64(b.Ticks) / BombDuration
+	return bombMaxR * t * (2 - t)
+}
+
+func (b *Bomb) update() error {
+	r := b.R()
+
+	_bullets := b.game.Bullets[:0]
+	for _, bl := range b.game.Bullets {
+		if bl.Pos.Sub(b.Pos).NormSq() > (r+bl.R)*(r+bl.R) {
+			_bullets = append(_bullets, bl)
+			continue
+		}
+
+		b.game.emit(EventBulletCanceled, bl.Pos, bl.R)
+	}
+	b.game.Bullets = _bullets
+
+	for _, l := range b.game.Lasers {
+		if l.collides(b.Pos, b.Pos, r) {
+			l.cancel()
+		}
+	}
+
+	if b.Ticks%bombHitInterval == 0 {
+		for _, e := range b.game.Enemies {
+			if e.Alive() && e.Pos.Sub(b.Pos).NormSq() < (r+e.R)*(r+e.R) {
+				e.hit = true
+			}
+		}
+	}
+
+	b.Ticks++
+
+	if b.Ticks >= BombDuration {
+		b.finished = true
+	}
+
+	return nil
+}
+
+// bomb fires a bomb if the player has any. A bomb fired while the player is
+// dying cancels the miss. Every enemy running a barrage loses the
+// zero-failure bonus of it.
+func (p *Player) bomb() {
+	if p.Bombs == 0 || p.Life <= 0 {
+		return
+	}
+
+	p.Bombs--
+	p.missAt = -1
+	p.invincibleUntil = p.Ticks + bombInvincibleTicks
+
+	for _, e := range p.game.Enemies {
+		if e.State == EnemyStateRunning {
+			e.bombsInBulletMLRunning++
+		}
+	}
+
+	b := &Bomb{
+		Pos:  p.Pos.Clone(),
+		game: p.game,
+	}
+	p.game.Bombs = append(p.game.Bombs, b)
+}
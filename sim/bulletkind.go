@@ -0,0 +1,56 @@
+package sim
+
+import (
+	"strings"
+
+	"github.com/tsujio/game-bullet-hell/shapeutil"
+)
+
+// BulletKind is the hitbox of bullets, which the renderer draws by Name. The
+// kind of a bullet is selected by the label of its <bullet> element. The
+// player grazes a bullet when it comes within grazeMargin of the hitbox, and
+// the hitbox of a rotating kind faces the direction the bullet travels.
+type BulletKind struct {
+	Name        string
+	Rotates     bool
+	shape       shapeutil.Shape
+	grazeMargin float64
+}
+
+var bulletKinds = map[string]*BulletKind{
+	"": {
+		shape: &shapeutil.Circle{R: BulletR},
+	},
+	"needle": {
+		Name:        "needle",
+		Rotates:     true,
+		shape:       &shapeutil.Capsule{L: 7, R: 1},
+		grazeMargin: 2,
+	},
+	"orb": {
+		Name:        "orb",
+		shape:       &shapeutil.Circle{R: 8},
+		grazeMargin: 4,
+	},
+	"rice": {
+		Name:        "rice",
+		Rotates:     true,
+		shape:       &shapeutil.Ellipse{A: 4.5, B: 2.5},
+		grazeMargin: 1.5,
+	},
+}
+
+// bulletKindOf returns the kind registered for the label. A label such as
+// "needle-fast" falls back to the kind of its prefix, and unknown labels use
+// the default kind.
+func bulletKindOf(label string) *BulletKind {
+	if k, exists := bulletKinds[label]; exists {
+		return k
+	}
+	if prefix, _, found := strings.Cut(label, "-"); found {
+		if k, exists := bulletKinds[prefix]; exists {
+			return k
+		}
+	}
+	return bulletKinds[""]
+}
@@ -0,0 +1,93 @@
+package sim
+
+import "math"
+
+// Difficulty is a set of parameters selected on the title screen. Rank is
+// the initial $rank of BulletML, which changes with the play within RankMin
+// and RankMax. EnemyLifeScale scales the enemy life of every barrage and
+// ScoreScale scales every score gain. A bomb fired within DeathbombWindow
+// ticks after the player is hit cancels the miss.
+type Difficulty struct {
+	Name            string
+	Rank            float64
+	RankMin         float64
+	RankMax         float64
+	PlayerLife      int
+	EnemyLifeScale  float64
+	ScoreScale      float64
+	DeathbombWindow int
+}
+
+var Difficulties = []*Difficulty{
+	{
+		Name:            "EASY",
+		Rank:            0.2,
+		RankMin:         0.0,
+		RankMax:         0.4,
+		PlayerLife:      8,
+		EnemyLifeScale:  0.7,
+		ScoreScale:      0.5,
+		DeathbombWindow: 15,
+	},
+	{
+		Name:            "NORMAL",
+		Rank:            0.5,
+		RankMin:         0.3,
+		RankMax:         0.8,
+		PlayerLife:      6,
+		EnemyLifeScale:  1.0,
+		ScoreScale:      1.0,
+		DeathbombWindow: 10,
+	},
+	{
+		Name:            "HARD",
+		Rank:            0.8,
+		RankMin:         0.6,
+		RankMax:         1.0,
+		PlayerLife:      5,
+		EnemyLifeScale:  1.3,
+		ScoreScale:      1.5,
+		DeathbombWindow: 8,
+	},
+	{
+		Name:            "LUNATIC",
+		Rank:            1.0,
+		RankMin:         0.8,
+		RankMax:         1.0,
+		PlayerLife:      4,
+		EnemyLifeScale:  1.6,
+		ScoreScale:      2.0,
+		DeathbombWindow: 6,
+	},
+}
+
+// MaxPlayerLife returns the largest starting life of the difficulties.
+func MaxPlayerLife() int {
+	max := 0
+	for _, d := range Difficulties {
+		if d.PlayerLife > max {
+			max = d.PlayerLife
+		}
+	}
+	return max
+}
+
+func (g *Game) enemyLife(b *Barrage) float64 {
+	return b.EnemyLife * g.Difficulty.EnemyLifeScale
+}
+
+// addScore adds the gain scaled by the difficulty. The scaled gain is rounded
+// so that small gains still score on the difficulties scaling them down.
+func (g *Game) addScore(v int) {
+	g.Score += int(math.Round(float64(v) * g.Difficulty.ScoreScale))
+}
+
+// DifficultyByName returns the difficulty named name, or nil if none.
+func DifficultyByName(name string) *Difficulty {
+	for _, d := range Difficulties {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package sim
+
+import "github.com/tsujio/game-util/mathutil"
+
+// EventKind is a kind of the things which happen in a tick and have no effect
+// on the play but are shown by the renderer.
+type EventKind int
+
+const (
+	// EventBulletCanceled is a bullet removed by a barrage end, a bomb or a
+	// miss at Pos.
+	EventBulletCanceled EventKind = iota
+	// EventEnemyHit is a player bullet hitting an enemy at Pos.
+	EventEnemyHit
+	// EventGraze is the player grazing a bullet at Pos.
+	EventGraze
+	// EventLaserGraze is the player at Pos grazing a laser.
+	EventLaserGraze
+	// EventMiss is the player missing at Pos.
+	EventMiss
+	// EventEnemyExploded is an enemy of radius R exploding at Pos.
+	EventEnemyExploded
+)
+
+// Event is a thing which happened in the last tick.
+type Event struct {
+	Kind EventKind
+	Pos  *mathutil.Vector2D
+	R    float64
+}
+
+func (g *Game) emit(kind EventKind, pos *mathutil.Vector2D, r float64) {
+	g.Events = append(g.Events, Event{Kind: kind, Pos: pos.Clone(), R: r})
+}
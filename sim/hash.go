@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// StateHash returns the FNV-1a hash of the position and the life of the
+// player, the score, the graze, the state and the life of every enemy and
+// the position of every bullet. Runs with the same seed, difficulty, stage
+// and input frames have the same hash after every tick.
+func (g *Game) StateHash() uint64 {
+	var buf []byte
+	putInt := func(v int) {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+	}
+	putFloat := func(v float64) {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+	}
+
+	putFloat(g.Player.Pos.X)
+	putFloat(g.Player.Pos.Y)
+	putInt(g.Player.Life)
+	putInt(g.Score)
+	putInt(g.Graze)
+
+	putInt(len(g.Enemies))
+	for _, e := range g.Enemies {
+		putInt(int(e.State))
+		putFloat(e.Life)
+	}
+
+	putInt(len(g.Bullets))
+	for _, b := range g.Bullets {
+		putFloat(b.Pos.X)
+		putFloat(b.Pos.Y)
+	}
+
+	h := fnv.New64a()
+	h.Write(buf)
+	return h.Sum64()
+}
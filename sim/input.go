@@ -0,0 +1,29 @@
+package sim
+
+import "github.com/tsujio/game-util/mathutil"
+
+const (
+	PlayerSpeed      = 4
+	PlayerFocusSpeed = 1.5
+	InputMoveScale   = 256
+)
+
+// InputFrame is the input consumed by a tick of the play. Move is the
+// movement by the keyboard and gamepads, which slows down while focused, and
+// Drag is the movement by pointers, which the player follows as is. The
+// movements are in 1/InputMoveScale pixels so that a recorded frame
+// reproduces the tick exactly.
+type InputFrame struct {
+	MoveX, MoveY int
+	DragX, DragY int
+	Focus        bool
+	Bomb         bool
+}
+
+func (f InputFrame) move() *mathutil.Vector2D {
+	return mathutil.NewVector2D(float64(f.MoveX)/InputMoveScale, float64(f.MoveY)/InputMoveScale)
+}
+
+func (f InputFrame) drag() *mathutil.Vector2D {
+	return mathutil.NewVector2D(float64(f.DragX)/InputMoveScale, float64(f.DragY)/InputMoveScale)
+}
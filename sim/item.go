@@ -0,0 +1,159 @@
+package sim
+
+import (
+	"github.com/tsujio/game-util/mathutil"
+)
+
+const (
+	ItemR                 = 4
+	itemGravity           = 0.08
+	itemMaxFallSpeed      = 2.5
+	itemMaxSpeed          = 12
+	itemCollectLineY      = ScreenHeight / 4
+	itemCollectDelay      = 40
+	itemPointValue        = 100
+	itemPowerValue        = 10
+	itemPiecesPerUnit     = 3
+	cancelItemValue       = 10
+	cancelItemDensityStep = 50
+)
+
+type ItemKind int
+
+const (
+	ItemKindPoint ItemKind = iota
+	ItemKindPower
+	ItemKindLifePiece
+	ItemKindBombPiece
+)
+
+// itemKindNames maps the names used in the stage manifest to item kinds.
+var itemKindNames = map[string]ItemKind{
+	"point":     ItemKindPoint,
+	"power":     ItemKindPower,
+	"lifePiece": ItemKindLifePiece,
+	"bombPiece": ItemKindBombPiece,
+}
+
+// Drop is an entry of the drop table of a barrage. Count items of Kind are
+// dropped when the enemy is defeated in the barrage.
+type Drop struct {
+	Kind  ItemKind
+	Count int
+}
+
+// Item pops up and falls by gravity until it is attracted to the player. It
+// is attracted when the player comes above itemCollectLineY, or after
+// collectAt ticks if collectAt is not negative. A point item is worth its
+// full value if collected above the line or by attraction, and less the lower
+// it is collected otherwise.
+type Item struct {
+	Ticks      int
+	Pos        *mathutil.Vector2D
+	v          *mathutil.Vector2D
+	Kind       ItemKind
+	value      int
+	collectAt  int
+	magnet     bool
+	magnetTick int
+	finished   bool
+	game       *Game
+}
+
+func (i *Item) update() error {
+	p := i.game.Player
+
+	if !i.magnet && p.Life > 0 &&
+		(p.Pos.Y < itemCollectLineY || i.collectAt >= 0 && i.Ticks >= i.collectAt) {
+		i.magnet = true
+		i.magnetTick = i.Ticks
+	}
+
+	if i.magnet {
+		speed := float64(i.Ticks-i.magnetTick) / 4
+		if speed > itemMaxSpeed {
+			speed = itemMaxSpeed
+		}
+		if d := p.Pos.Sub(i.Pos); d.NormSq() > 0 {
+			i.v = d.Normalize().Mul(speed)
+		}
+	} else {
+		i.v.X *= 0.95
+		i.v.Y += itemGravity
+		if i.v.Y > itemMaxFallSpeed {
+			i.v.Y = itemMaxFallSpeed
+		}
+	}
+
+	i.Pos = i.Pos.Add(i.v)
+
+	if p.Life > 0 && i.Pos.Sub(p.Pos).NormSq() < (p.GrazeR+ItemR)*(p.GrazeR+ItemR) {
+		i.collect()
+		i.finished = true
+	}
+
+	if i.Pos.Y-ItemR > ScreenHeight {
+		i.finished = true
+	}
+
+	i.Ticks++
+
+	return nil
+}
+
+func (i *Item) collect() {
+	p := i.game.Player
+
+	switch i.Kind {
+	case ItemKindPoint:
+		value := i.value
+		if !i.magnet {
+			rate := 1 - 0.8*(i.Pos.Y-itemCollectLineY)/(ScreenHeight-itemCollectLineY)
+			value = int(float64(value) * rate)
+		}
+		i.game.addScore(value)
+	case ItemKindPower:
+		if p.Power < MaxPlayerPower {
+			p.Power++
+		}
+		i.game.addScore(itemPowerValue)
+	case ItemKindLifePiece:
+		p.lifePieces++
+		if p.lifePieces >= itemPiecesPerUnit {
+			p.lifePieces = 0
+			if p.Life < MaxPlayerLife() {
+				p.Life++
+			}
+		}
+	case ItemKindBombPiece:
+		p.bombPieces++
+		if p.bombPieces >= itemPiecesPerUnit {
+			p.bombPieces = 0
+			p.Bombs++
+		}
+	}
+}
+
+// dropItems scatters the items of the drop table around pos.
+func (g *Game) dropItems(pos *mathutil.Vector2D, drops []*Drop) {
+	for _, d := range drops {
+		for j := 0; j < d.Count; j++ {
+			i := &Item{
+				Pos:       pos.Add(mathutil.NewVector2D(20*g.random.Float64()-10, 20*g.random.Float64()-10)),
+				v:         mathutil.NewVector2D(3*g.random.Float64()-1.5, -2-2*g.random.Float64()),
+				Kind:      d.Kind,
+				value:     itemPointValue,
+				collectAt: -1,
+				game:      g,
+			}
+			g.Items = append(g.Items, i)
+		}
+	}
+}
+
+// cancelItemValueOf returns the value of each item converted from n canceled
+// bullets. The value grows with the number of bullets, so the total of a
+// dense barrage grows faster than the number of its bullets.
+func cancelItemValueOf(n int) int {
+	return cancelItemValue * (1 + n/cancelItemDensityStep)
+}
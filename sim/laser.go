@@ -0,0 +1,147 @@
+package sim
+
+import (
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/tsujio/game-bullet-hell/shapeutil"
+	"github.com/tsujio/game-util/mathutil"
+	"github.com/tsujio/go-bulletml"
+)
+
+const (
+	laserGrazeMargin = 8
+	laserGrazeGain   = 1
+)
+
+// LaserKind is the shape and the timeline of lasers. A <bullet> element labeled
+// with the name of a laser kind, optionally followed by "-" and any suffix,
+// emits a laser instead of a bullet. The laser shows a warning line for
+// Warning ticks, grows to Width in Grow ticks, stays for Active ticks and
+// fades out in Fade ticks.
+type LaserKind struct {
+	Name                        string
+	Width, Length               float64
+	Warning, Grow, Active, Fade int
+}
+
+var laserKinds = map[string]*LaserKind{
+	"laser": {
+		Name:    "laser",
+		Width:   10,
+		Length:  800,
+		Warning: 60,
+		Grow:    10,
+		Active:  90,
+		Fade:    20,
+	},
+	"beam": {
+		Name:    "beam",
+		Width:   40,
+		Length:  800,
+		Warning: 90,
+		Grow:    20,
+		Active:  120,
+		Fade:    30,
+	},
+}
+
+// laserKindOf returns the laser kind for the label, or nil if the label does
+// not designate a laser.
+func laserKindOf(label string) *LaserKind {
+	if k, exists := laserKinds[label]; exists {
+		return k
+	}
+	if prefix, _, found := strings.Cut(label, "-"); found {
+		return laserKinds[prefix]
+	}
+	return nil
+}
+
+// Laser is a beam emitted from its enemy. Its direction follows the motion of
+// the bullet runner that emitted it, so BulletML can sweep the beam.
+type Laser struct {
+	Ticks    int
+	Origin   *mathutil.Vector2D
+	Dir      float64
+	Kind     *LaserKind
+	finished bool
+	runner   bulletml.BulletRunner
+	enemy    *Enemy
+}
+
+func (l *Laser) update() error {
+	if l.enemy.Alive() {
+		l.Origin = l.enemy.Pos.Clone()
+	}
+
+	x0, y0 := l.runner.Position()
+	if err := l.runner.Update(); err != nil {
+		return err
+	}
+	if x, y := l.runner.Position(); x != x0 || y != y0 {
+		l.Dir = math.Atan2(y-y0, x-x0)
+	}
+
+	l.Ticks++
+
+	if l.Ticks >= l.Kind.Warning+l.Kind.Grow+l.Kind.Active+l.Kind.Fade {
+		l.finished = true
+	}
+
+	return nil
+}
+
+// firedDirection returns the direction the bullet of br was fired in. The
+// runner of go-bulletml does not expose it, so it is read from the bullet
+// model of the runner, and ok is false if the runner has no such field.
+func firedDirection(br bulletml.BulletRunner) (dir float64, ok bool) {
+	v := reflect.ValueOf(br)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return 0, false
+	}
+	b := v.Elem().FieldByName("bullet")
+	if b.Kind() != reflect.Pointer || b.IsNil() || b.Elem().Kind() != reflect.Struct {
+		return 0, false
+	}
+	d := b.Elem().FieldByName("direction")
+	if d.Kind() != reflect.Float64 {
+		return 0, false
+	}
+	return d.Float(), true
+}
+
+// harmful reports whether the laser hits the player in the current phase.
+func (l *Laser) harmful() bool {
+	return l.Ticks >= l.Kind.Warning && l.Ticks < l.Kind.Warning+l.Kind.Grow+l.Kind.Active
+}
+
+func (l *Laser) Width() float64 {
+	k := l.Kind
+	switch t := l.Ticks; {
+	case t < k.Warning:
+		return 0
+	case t < k.Warning+k.Grow:
+		return k.Width * float64(t-k.Warning) / float64(k.Grow)
+	case t < k.Warning+k.Grow+k.Active:
+		return k.Width
+	default:
+		return k.Width * (1 - float64(t-k.Warning-k.Grow-k.Active)/float64(k.Fade))
+	}
+}
+
+// cancel makes the laser fade out immediately.
+func (l *Laser) cancel() {
+	if l.Ticks < l.Kind.Warning {
+		l.finished = true
+	} else if end := l.Kind.Warning + l.Kind.Grow + l.Kind.Active; l.Ticks < end {
+		l.Ticks = end
+	}
+}
+
+func (l *Laser) collides(pos, prevPos *mathutil.Vector2D, r float64) bool {
+	center := l.Origin.Add(mathutil.NewVector2D(math.Cos(l.Dir), math.Sin(l.Dir)).Mul(l.Kind.Length / 2))
+	shape := &shapeutil.Capsule{L: l.Kind.Length / 2, R: l.Width() / 2}
+	return shapeutil.Collide(shape, center, center, l.Dir, pos, prevPos, r)
+}
@@ -0,0 +1,100 @@
+package sim
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+const (
+	rankGrazeStep      = 0.002
+	rankNoMissStep     = 0.05
+	rankNoMissInterval = 60 * 10
+	rankMissStep       = 0.1
+	rankSampleInterval = 60
+)
+
+// RankSample is the rank at a tick of the stage.
+type RankSample struct {
+	Tick int
+	Rank float64
+}
+
+// Rank is the dynamic rank passed to newly created BulletML runners. It
+// starts from the rank of the difficulty, rises while the player grazes and
+// survives, and falls on every miss by an amount growing with the failures in
+// the running barrage. It stays within the bounds of the difficulty.
+type Rank struct {
+	Value          float64
+	min, max       float64
+	ticks          int
+	ticksSinceMiss int
+	graze          int
+	History        []RankSample
+}
+
+func newRank(d *Difficulty) *Rank {
+	return &Rank{
+		Value:   d.Rank,
+		min:     d.RankMin,
+		max:     d.RankMax,
+		History: []RankSample{{Tick: 0, Rank: d.Rank}},
+	}
+}
+
+func (r *Rank) update(graze int) {
+	r.ticks++
+	r.ticksSinceMiss++
+
+	r.add(rankGrazeStep * float64(graze-r.graze))
+	r.graze = graze
+
+	if r.ticksSinceMiss%rankNoMissInterval == 0 {
+		r.add(rankNoMissStep)
+	}
+
+	if r.ticks%rankSampleInterval == 0 {
+		r.History = append(r.History, RankSample{Tick: r.ticks, Rank: r.Value})
+	}
+}
+
+func (r *Rank) miss(failures int) {
+	r.ticksSinceMiss = 0
+	r.add(-rankMissStep * float64(failures))
+	r.History = append(r.History, RankSample{Tick: r.ticks, Rank: r.Value})
+}
+
+func (r *Rank) add(v float64) {
+	r.Value += v
+	if r.Value < r.min {
+		r.Value = r.min
+	}
+	if r.Value > r.max {
+		r.Value = r.max
+	}
+}
+
+// WriteRankHistory writes the history as CSV lines of tick and rank.
+func WriteRankHistory(name string, history []RankSample) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"tick", "rank"}); err != nil {
+		return err
+	}
+	for _, s := range history {
+		if err := w.Write([]string{strconv.Itoa(s.Tick), strconv.FormatFloat(s.Rank, 'f', 4, 64)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
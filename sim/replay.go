@@ -0,0 +1,287 @@
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A replay file records the input of a run, which reproduces the run since
+// the simulation is deterministic for the same seed, difficulty and stage.
+// The file is
+//
+//	magic       "BHRP"
+//	version     uvarint, replayVersion
+//	body        gzip stream of the following fields
+//
+// and the body is
+//
+//	seed        varint, the seed passed to NewGame
+//	difficulty  uvarint length followed by the bytes of the difficulty name
+//	stage hash  32 bytes, Stage.Hash of the stage played
+//	score       varint, the score at game over
+//	ticks       uvarint, the number of frames
+//	runs        runs of frames until ticks frames are read
+//	hashes      uvarint count followed by count 4-byte little endian hashes
+//
+// where each run is
+//
+//	count       uvarint, the number of consecutive identical frames
+//	flags       1 byte, bit 0 for InputFrame.Focus and bit 1 for InputFrame.Bomb
+//	move        varint MoveX followed by varint MoveY
+//	drag        varint DragX followed by varint DragY
+//
+// and the i-th hash is the folded Game.StateHash after i+1 ticks.
+// All integers are encoded with encoding/binary. Readers reject files with
+// other versions, and the version is also bumped when the simulation changes
+// so that replays of older builds are not played back as desyncs.
+const (
+	replayMagic   = "BHRP"
+	replayVersion = 7
+)
+
+const (
+	replayFlagFocus = 1 << iota
+	replayFlagBomb
+)
+
+// Replay is the record of a run. Hashes are the state hashes after every tick
+// folded into 32 bits, which detect the exact tick a playback desyncs at.
+type Replay struct {
+	Seed       int64
+	Difficulty string
+	StageHash  [sha256.Size]byte
+	Score      int
+	Frames     []InputFrame
+	Hashes     []uint32
+}
+
+// Record appends the frame of a tick just stepped in g with the state hash
+// after the tick.
+func (r *Replay) Record(g *Game, frame InputFrame) {
+	r.Frames = append(r.Frames, frame)
+	r.Hashes = append(r.Hashes, foldHash(g.StateHash()))
+}
+
+// Check compares the state of g after the given number of ticks with the
+// hash recorded for it, if any. It returns an error on a mismatch.
+func (r *Replay) Check(g *Game, ticks int) error {
+	i := ticks - 1
+	if i < 0 || i >= len(r.Hashes) || r.Hashes[i] == foldHash(g.StateHash()) {
+		return nil
+	}
+	return fmt.Errorf("replay: desync at tick %d", ticks)
+}
+
+// foldHash folds the state hash into 32 bits, which keep replays small while
+// telling a desync apart almost surely.
+func foldHash(h uint64) uint32 {
+	return uint32(h ^ h>>32)
+}
+
+// Verify plays the replay on the stage and returns an error if the play
+// differs from the recorded one.
+func (r *Replay) Verify(stage *Stage) error {
+	d := DifficultyByName(r.Difficulty)
+	if d == nil {
+		return fmt.Errorf("replay: unknown difficulty %q", r.Difficulty)
+	}
+	if r.StageHash != stage.Hash {
+		return errors.New("replay: recorded on another stage")
+	}
+
+	g := NewGame(stage, d, r.Seed)
+	for i, f := range r.Frames {
+		if err := g.Step(f); err != nil {
+			return err
+		}
+		if err := r.Check(g, i+1); err != nil {
+			return err
+		}
+	}
+
+	if g.Score != r.Score {
+		return fmt.Errorf("replay: score %d differs from recorded %d", g.Score, r.Score)
+	}
+
+	return nil
+}
+
+func (r *Replay) Encode(w io.Writer) error {
+	var buf []byte
+	buf = append(buf, replayMagic...)
+	buf = binary.AppendUvarint(buf, replayVersion)
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+
+	buf = buf[:0]
+	buf = binary.AppendVarint(buf, r.Seed)
+	buf = binary.AppendUvarint(buf, uint64(len(r.Difficulty)))
+	buf = append(buf, r.Difficulty...)
+	buf = append(buf, r.StageHash[:]...)
+	buf = binary.AppendVarint(buf, int64(r.Score))
+	buf = binary.AppendUvarint(buf, uint64(len(r.Frames)))
+
+	for i := 0; i < len(r.Frames); {
+		f := r.Frames[i]
+		n := 1
+		for i+n < len(r.Frames) && r.Frames[i+n] == f {
+			n++
+		}
+
+		var flags byte
+		if f.Focus {
+			flags |= replayFlagFocus
+		}
+		if f.Bomb {
+			flags |= replayFlagBomb
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(n))
+		buf = append(buf, flags)
+		buf = binary.AppendVarint(buf, int64(f.MoveX))
+		buf = binary.AppendVarint(buf, int64(f.MoveY))
+		buf = binary.AppendVarint(buf, int64(f.DragX))
+		buf = binary.AppendVarint(buf, int64(f.DragY))
+
+		i += n
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(r.Hashes)))
+	for _, h := range r.Hashes {
+		buf = binary.LittleEndian.AppendUint32(buf, h)
+	}
+
+	if _, err := zw.Write(buf); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func (r *Replay) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	if err := r.Encode(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func DecodeReplay(rd io.Reader) (*Replay, error) {
+	br := bufio.NewReader(rd)
+
+	magic := make([]byte, len(replayMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != replayMagic {
+		return nil, errors.New("replay: not a replay file")
+	}
+
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if version != replayVersion {
+		return nil, fmt.Errorf("replay: unsupported version %d", version)
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	body := bufio.NewReader(zr)
+
+	r := &Replay{}
+
+	if r.Seed, err = binary.ReadVarint(body); err != nil {
+		return nil, err
+	}
+
+	n, err := binary.ReadUvarint(body)
+	if err != nil {
+		return nil, err
+	}
+	if n > 64 {
+		return nil, errors.New("replay: too long difficulty name")
+	}
+	name := make([]byte, n)
+	if _, err := io.ReadFull(body, name); err != nil {
+		return nil, err
+	}
+	r.Difficulty = string(name)
+
+	if _, err := io.ReadFull(body, r.StageHash[:]); err != nil {
+		return nil, err
+	}
+
+	score, err := binary.ReadVarint(body)
+	if err != nil {
+		return nil, err
+	}
+	r.Score = int(score)
+
+	ticks, err := binary.ReadUvarint(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for uint64(len(r.Frames)) < ticks {
+		count, err := binary.ReadUvarint(body)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 || uint64(len(r.Frames))+count > ticks {
+			return nil, errors.New("replay: broken run of frames")
+		}
+
+		flags, err := body.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		var v [4]int64
+		for i := range v {
+			if v[i], err = binary.ReadVarint(body); err != nil {
+				return nil, err
+			}
+		}
+
+		f := InputFrame{
+			MoveX: int(v[0]),
+			MoveY: int(v[1]),
+			DragX: int(v[2]),
+			DragY: int(v[3]),
+			Focus: flags&replayFlagFocus != 0,
+			Bomb:  flags&replayFlagBomb != 0,
+		}
+		for i := uint64(0); i < count; i++ {
+			r.Frames = append(r.Frames, f)
+		}
+	}
+
+	hashes, err := binary.ReadUvarint(body)
+	if err != nil {
+		return nil, err
+	}
+	if hashes > ticks {
+		return nil, errors.New("replay: too many hashes")
+	}
+	for i := uint64(0); i < hashes; i++ {
+		var h [4]byte
+		if _, err := io.ReadFull(body, h[:]); err != nil {
+			return nil, err
+		}
+		r.Hashes = append(r.Hashes, binary.LittleEndian.Uint32(h[:]))
+	}
+
+	return r, nil
+}
@@ -0,0 +1,70 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordReplay records a run with the scripted input until it is over or
+// ticks ticks pass.
+func recordReplay(t *testing.T, stage *Stage, d *Difficulty, seed int64, ticks int) *Replay {
+	t.Helper()
+
+	g := NewGame(stage, d, seed)
+	r := &Replay{
+		Seed:       seed,
+		Difficulty: d.Name,
+		StageHash:  stage.Hash,
+	}
+	for i := 0; i < ticks && !g.Over(); i++ {
+		f := testFrame(i)
+		if err := g.Step(f); err != nil {
+			t.Fatal(err)
+		}
+		r.Record(g, f)
+	}
+	r.Score = g.Score
+
+	return r
+}
+
+func TestReplayEncodeDecode(t *testing.T) {
+	stage := loadTestStage(t)
+	r := recordReplay(t, stage, Difficulties[2], 7, 60*60)
+
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeReplay(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, r) {
+		t.Errorf("decoded replay differs from the encoded one")
+	}
+
+	if err := decoded.Verify(stage); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+func TestReplayDesync(t *testing.T) {
+	stage := loadTestStage(t)
+	r := recordReplay(t, stage, Difficulties[1], 7, 600)
+
+	// The frame is input at tick 101.
+	r.Frames[100].MoveX += InputMoveScale
+
+	err := r.Verify(stage)
+	if err == nil {
+		t.Fatal("verify succeeded with an altered frame")
+	}
+	if !strings.Contains(err.Error(), "tick 101") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
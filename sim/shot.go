@@ -0,0 +1,70 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/tsujio/game-util/mathutil"
+)
+
+const (
+	MaxPlayerPower      = 32
+	missPowerLoss       = 8
+	playerBulletSpeed   = 10
+	focusShotWidthScale = 0.4
+)
+
+// ShotLevel is the shot pattern of the player while the power is at least
+// Power. Streams are fired every Interval ticks from points up to Width
+// apart from the player, and the outermost streams spread by Spread radians.
+// Streams get narrow and parallel while the player is focused.
+type ShotLevel struct {
+	Power    int
+	Interval int
+	Streams  int
+	Width    float64
+	Spread   float64
+}
+
+var shotLevels = []*ShotLevel{
+	{Power: 0, Interval: 5, Streams: 2, Width: 10, Spread: 0},
+	{Power: 4, Interval: 5, Streams: 3, Width: 10, Spread: math.Pi / 36},
+	{Power: 10, Interval: 4, Streams: 4, Width: 14, Spread: math.Pi / 18},
+	{Power: 20, Interval: 4, Streams: 5, Width: 16, Spread: math.Pi / 12},
+	{Power: MaxPlayerPower, Interval: 3, Streams: 6, Width: 20, Spread: math.Pi / 9},
+}
+
+// ShotLevelIndex returns the index of the shot level for the power.
+func ShotLevelIndex(power int) int {
+	level := 0
+	for i, l := range shotLevels {
+		if power >= l.Power {
+			level = i
+		}
+	}
+	return level
+}
+
+func (p *Player) shoot() {
+	l := shotLevels[ShotLevelIndex(p.Power)]
+	if p.Ticks%l.Interval != 0 {
+		return
+	}
+
+	width, spread := l.Width, l.Spread
+	if p.Focused {
+		width, spread = width*focusShotWidthScale, 0
+	}
+
+	for i := 0; i < l.Streams; i++ {
+		// -1 at the leftmost stream and 1 at the rightmost
+		t := float64(i*2-(l.Streams-1)) / float64(l.Streams-1)
+		d := -math.Pi/2 + spread*t
+		b := &PlayerBullet{
+			Pos: p.Pos.Add(mathutil.NewVector2D(t*width, -3)),
+			v:   mathutil.NewVector2D(math.Cos(d), math.Sin(d)).Mul(playerBulletSpeed),
+			R:   PlayerBulletR,
+		}
+		b.prevPos = b.Pos
+		p.game.PlayerBullets = append(p.game.PlayerBullets, b)
+	}
+}
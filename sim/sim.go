@@ -0,0 +1,911 @@
+// Package sim is the simulation of the game. It has no dependency on the
+// renderer and the input devices, and is stepped tick by tick with recorded
+// or live input frames. The same seed, difficulty, stage and input frames
+// always reproduce the same play.
+package sim
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/tsujio/game-bullet-hell/shapeutil"
+	"github.com/tsujio/game-util/mathutil"
+	"github.com/tsujio/go-bulletml"
+)
+
+const (
+	ScreenWidth              = 640
+	ScreenHeight             = 480
+	PlayerR                  = 4
+	playerGrazeR             = 8
+	PlayerBulletR            = 3
+	EnemyR                   = 20
+	popcornR                 = 10
+	BulletR                  = 3
+	PlayerHomeX, PlayerHomeY = ScreenWidth / 2, ScreenHeight * 4 / 5
+	enemyHomeX, enemyHomeY   = ScreenWidth / 2, ScreenHeight * 1 / 5
+	grazeGain                = 10
+)
+
+// Game is the state of a play. Events are the events of the last tick. OnMiss,
+// if set, is called when the player misses.
+type Game struct {
+	Player        *Player
+	Boss          *Enemy
+	Enemies       []*Enemy
+	Bullets       []*Bullet
+	Lasers        []*Laser
+	Items         []*Item
+	Bombs         []*Bomb
+	PlayerBullets []*PlayerBullet
+	Events        []Event
+	Score         int
+	Graze         int
+	Difficulty    *Difficulty
+	Rank          *Rank
+	OnMiss        func()
+	stage         *Stage
+	stageTicks    int
+	random        *rand.Rand
+	frame         InputFrame
+	over          bool
+}
+
+// NewGame returns the play of the stage before its first tick. The random
+// generator is seeded with seed.
+func NewGame(stage *Stage, difficulty *Difficulty, seed int64) *Game {
+	g := &Game{
+		Difficulty: difficulty,
+		Rank:       newRank(difficulty),
+		stage:      stage,
+		random:     rand.New(rand.NewSource(seed)),
+	}
+
+	playerPos := mathutil.NewVector2D(PlayerHomeX, PlayerHomeY)
+	g.Player = &Player{
+		Pos:             playerPos,
+		prevPos:         playerPos,
+		R:               PlayerR,
+		GrazeR:          playerGrazeR,
+		Life:            difficulty.PlayerLife,
+		Bombs:           playerInitialBombs,
+		invincibleUntil: -1,
+		missAt:          -1,
+		game:            g,
+	}
+
+	enemyPos := mathutil.NewVector2D(enemyHomeX, enemyHomeY+80)
+	g.Boss = &Enemy{
+		Pos:                 enemyPos,
+		prevPos:             enemyPos,
+		home:                mathutil.NewVector2D(enemyHomeX, enemyHomeY),
+		R:                   EnemyR,
+		State:               EnemyStateWaiting,
+		Life:                g.enemyLife(stage.Barrages[0]),
+		MaxLife:             g.enemyLife(stage.Barrages[0]),
+		barrages:            stage.Barrages,
+		startNextBulletMLAt: stage.Barrages[0].Delay,
+		game:                g,
+	}
+
+	return g
+}
+
+// Over reports whether the player has lost all lives or cleared the stage.
+func (g *Game) Over() bool {
+	return g.over
+}
+
+func isIn[T comparable](v T, values ...T) bool {
+	for _, val := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+type EnemyState int
+
+const (
+	EnemyStateWaiting = iota
+	EnemyStateRunning
+	EnemyStateFlashing
+	EnemyStateExploded
+	EnemyStateLeft
+)
+
+type Enemy struct {
+	Ticks                     int
+	Pos, prevPos              *mathutil.Vector2D
+	home                      *mathutil.Vector2D
+	R                         float64
+	State                     EnemyState
+	hit                       bool
+	Life                      float64
+	MaxLife                   float64
+	barrages                  []*Barrage
+	bulletMLIndex             int
+	startNextBulletMLAt       int
+	timeLimitAt               int
+	explodeAt                 int
+	failuresInBulletMLRunning int
+	bombsInBulletMLRunning    int
+	waypoints                 []*mathutil.Vector2D
+	waypointIndex             int
+	speed                     float64
+	runner                    bulletml.Runner
+	game                      *Game
+}
+
+func (e *Enemy) update() error {
+	e.prevPos = e.Pos.Clone()
+
+	switch e.State {
+	case EnemyStateWaiting:
+		e.Pos = e.Pos.Add(e.home.Sub(e.Pos).Div(60))
+
+		if e.Ticks >= e.startNextBulletMLAt {
+			if err := e.setBulletML(); err != nil {
+				return err
+			}
+			e.timeLimitAt = e.Ticks + e.barrages[e.bulletMLIndex].TimeLimit
+			e.State = EnemyStateRunning
+		}
+	case EnemyStateRunning:
+		// The runner is nil after a barrage failed to restart, and the
+		// enemy idles until it is restarted again.
+		if e.runner != nil {
+			if err := e.runner.Update(); err != nil {
+				return &BarrageError{Path: e.barrages[e.bulletMLIndex].Path, Err: err}
+			}
+		}
+
+		if e.waypoints != nil {
+			e.followWaypoints()
+			if e.waypointIndex == len(e.waypoints) {
+				e.runner = nil
+				e.State = EnemyStateLeft
+				break
+			}
+		} else if e.runner != nil {
+			e.Pos.X, e.Pos.Y = e.runner.(bulletml.BulletRunner).Position()
+		}
+
+		barrage := e.barrages[e.bulletMLIndex]
+
+		if e.hit && !barrage.Survival {
+			e.Life -= 0.5
+		}
+
+		if e.Life <= 0 {
+			e.finishBulletML(true)
+		} else if barrage.TimeLimit > 0 && e.Ticks >= e.timeLimitAt {
+			e.finishBulletML(barrage.Survival)
+		}
+	case EnemyStateFlashing:
+		if e.Ticks == e.explodeAt {
+			e.game.emit(EventEnemyExploded, e.Pos, e.R)
+
+			e.State = EnemyStateExploded
+		}
+	case EnemyStateExploded:
+	case EnemyStateLeft:
+	}
+
+	if e.hit {
+		e.hit = false
+	}
+
+	e.Ticks++
+
+	return nil
+}
+
+func (e *Enemy) finishBulletML(cleared bool) {
+	e.cancelBullets(true)
+
+	barrage := e.barrages[e.bulletMLIndex]
+	if cleared {
+		e.game.addScore(barrage.ClearGain)
+		e.game.dropItems(e.Pos, barrage.Drops)
+	}
+	if e.failuresInBulletMLRunning == 0 && e.bombsInBulletMLRunning == 0 {
+		e.game.addScore(barrage.ZeroFailureGain)
+	} else if e.failuresInBulletMLRunning == 1 {
+		e.game.addScore(barrage.OneFailureGain)
+	}
+	e.failuresInBulletMLRunning = 0
+	e.bombsInBulletMLRunning = 0
+
+	e.runner = nil
+	e.bulletMLIndex++
+
+	if e.bulletMLIndex < len(e.barrages) {
+		next := e.barrages[e.bulletMLIndex]
+		e.startNextBulletMLAt = e.Ticks + next.Delay
+		e.Life = e.game.enemyLife(next)
+		e.MaxLife = e.Life
+		e.State = EnemyStateWaiting
+	} else {
+		e.Life = 0
+		if e.waypoints != nil {
+			e.explodeAt = e.Ticks + 1
+		} else {
+			e.explodeAt = e.Ticks + 120
+		}
+		e.State = EnemyStateFlashing
+	}
+}
+
+func (e *Enemy) followWaypoints() {
+	d := e.speed
+	for d > 0 && e.waypointIndex < len(e.waypoints) {
+		diff := e.waypoints[e.waypointIndex].Sub(e.Pos)
+		if n := diff.Norm(); n > d {
+			e.Pos = e.Pos.Add(diff.Mul(d / n))
+			d = 0
+		} else {
+			e.Pos = e.waypoints[e.waypointIndex].Clone()
+			d -= n
+			e.waypointIndex++
+		}
+	}
+}
+
+// cancelBullets removes the bullets and lasers of the enemy. The removed
+// bullets on screen turn into point items if toItems is true.
+func (e *Enemy) cancelBullets(toItems bool) {
+	n := 0
+	for _, b := range e.game.Bullets {
+		if b.enemy == e && b.OnScreen() {
+			n++
+		}
+	}
+	value := cancelItemValueOf(n)
+
+	_bullets := e.game.Bullets[:0]
+	for _, b := range e.game.Bullets {
+		if b.enemy != e {
+			_bullets = append(_bullets, b)
+			continue
+		}
+
+		e.game.emit(EventBulletCanceled, b.Pos, b.R)
+
+		if toItems && b.OnScreen() {
+			i := &Item{
+				Pos:       b.Pos.Clone(),
+				v:         mathutil.NewVector2D(e.game.random.Float64()-0.5, -1),
+				Kind:      ItemKindPoint,
+				value:     value,
+				collectAt: itemCollectDelay,
+				game:      e.game,
+			}
+			e.game.Items = append(e.game.Items, i)
+		}
+	}
+	e.game.Bullets = _bullets
+
+	for _, l := range e.game.Lasers {
+		if l.enemy == e {
+			l.cancel()
+		}
+	}
+}
+
+func (e *Enemy) Alive() bool {
+	return isIn(e.State, EnemyStateWaiting, EnemyStateRunning, EnemyStateFlashing)
+}
+
+func (e *Enemy) TimeLeft() int {
+	if e.State != EnemyStateRunning || e.barrages[e.bulletMLIndex].TimeLimit == 0 {
+		return -1
+	}
+	return e.timeLimitAt - e.Ticks
+}
+
+// Barrage returns the barrage the enemy runs or waits for, or nil if the
+// enemy has finished all of them.
+func (e *Enemy) Barrage() *Barrage {
+	if e.bulletMLIndex >= len(e.barrages) {
+		return nil
+	}
+	return e.barrages[e.bulletMLIndex]
+}
+
+// BarragesLeft returns the number of the barrages not finished yet.
+func (e *Enemy) BarragesLeft() int {
+	return len(e.barrages) - e.bulletMLIndex
+}
+
+// errNoBody is returned when the top action of a boss barrage fires no bullet
+// at its first tick, which would be the body of the boss.
+var errNoBody = errors.New("barrage: top action of the boss fires no bullet at the first tick")
+
+// BarrageError is an error of running the barrage of the file at Path.
+type BarrageError struct {
+	Path string
+	Err  error
+}
+
+func (e *BarrageError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *BarrageError) Unwrap() error {
+	return e.Err
+}
+
+// setBulletML starts the current barrage of the enemy. The runner of the
+// enemy is replaced only if the barrage starts.
+func (e *Enemy) setBulletML() error {
+	barrage := e.barrages[e.bulletMLIndex]
+	if err := e.startBulletML(barrage.BulletML); err != nil {
+		return &BarrageError{Path: barrage.Path, Err: err}
+	}
+	return nil
+}
+
+func (e *Enemy) startBulletML(bml *bulletml.BulletML) error {
+	// The boss is moved by the first bullet fired in its barrage, while
+	// popcorn enemies follow their waypoints and fire every bullet.
+	var body bulletml.BulletRunner
+	enemyRunner := e.waypoints == nil
+	opts := &bulletml.NewRunnerOptions{
+		OnBulletFired: func(br bulletml.BulletRunner, fc *bulletml.FireContext) {
+			if enemyRunner {
+				body = br
+				e.Pos.X, e.Pos.Y = br.Position()
+				enemyRunner = false
+			} else if k := laserKindOf(fc.Bullet.Label); k != nil {
+				x, y := br.Position()
+				dir, ok := firedDirection(br)
+				if !ok {
+					dir = math.Atan2(e.game.Player.Pos.Y-y, e.game.Player.Pos.X-x)
+				}
+				l := &Laser{
+					Origin: mathutil.NewVector2D(x, y),
+					Dir:    dir,
+					Kind:   k,
+					runner: br,
+					enemy:  e,
+				}
+				e.game.Lasers = append(e.game.Lasers, l)
+			} else {
+				x, y := br.Position()
+				kind := bulletKindOf(fc.Bullet.Label)
+				b := &Bullet{
+					Pos:     mathutil.NewVector2D(x, y),
+					prevPos: mathutil.NewVector2D(x, y),
+					Kind:    kind,
+					R:       kind.shape.Extent(),
+					runner:  br,
+					enemy:   e,
+					game:    e.game,
+				}
+				e.game.Bullets = append(e.game.Bullets, b)
+			}
+		},
+		CurrentShootPosition: func() (float64, float64) {
+			return e.Pos.X, e.Pos.Y
+		},
+		CurrentTargetPosition: func() (float64, float64) {
+			return e.game.Player.Pos.X, e.game.Player.Pos.Y
+		},
+		Random: e.game.random,
+		Rank:   e.game.Rank.Value,
+	}
+
+	runner, err := bulletml.NewRunner(bml, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := runner.Update(); err != nil {
+		return err
+	}
+
+	if e.waypoints != nil {
+		e.runner = runner
+		return nil
+	}
+
+	if body == nil {
+		return errNoBody
+	}
+	e.runner = body
+
+	return nil
+}
+
+type Bullet struct {
+	Pos, prevPos *mathutil.Vector2D
+	Dir          float64
+	Kind         *BulletKind
+	R            float64
+	hit          bool
+	grazed       bool
+	runner       bulletml.BulletRunner
+	enemy        *Enemy
+	game         *Game
+}
+
+func (b *Bullet) update() error {
+	b.prevPos = b.Pos.Clone()
+
+	if err := b.runner.Update(); err != nil {
+		return err
+	}
+
+	b.Pos.X, b.Pos.Y = b.runner.Position()
+
+	if v := b.Pos.Sub(b.prevPos); v.NormSq() > 0 {
+		b.Dir = math.Atan2(v.Y, v.X)
+	}
+
+	return nil
+}
+
+func (b *Bullet) collides(pos, prevPos *mathutil.Vector2D, r float64) bool {
+	var angle float64
+	if b.Kind.Rotates {
+		angle = b.Dir
+	}
+	return shapeutil.Collide(b.Kind.shape, b.Pos, b.prevPos, angle, pos, prevPos, r)
+}
+
+func (b *Bullet) OnScreen() bool {
+	return b.Pos.X-b.R > 0 && b.Pos.X+b.R < ScreenWidth && b.Pos.Y-b.R > 0 && b.Pos.Y+b.R < ScreenHeight
+}
+
+type Player struct {
+	Ticks           int
+	Pos, prevPos    *mathutil.Vector2D
+	R               float64
+	GrazeR          float64
+	invincibleUntil int
+	hit             bool
+	missAt          int
+	Focused         bool
+	Life            int
+	lifePieces      int
+	Power           int
+	Bombs           int
+	bombPieces      int
+	game            *Game
+}
+
+func (p *Player) Invincible() bool {
+	return p.Ticks <= p.invincibleUntil
+}
+
+// KeepInvincible makes the player invincible for the rest of the play, which
+// also stops its shots, so that barrages run undisturbed by the player.
+func (p *Player) KeepInvincible() {
+	p.invincibleUntil = math.MaxInt
+}
+
+// Dying reports whether the player has been hit and a bomb can still cancel
+// the miss.
+func (p *Player) Dying() bool {
+	return p.missAt >= 0
+}
+
+func (p *Player) update() error {
+	p.prevPos = p.Pos.Clone()
+
+	if p.hit {
+		p.missAt = p.Ticks + p.game.Difficulty.DeathbombWindow
+		p.hit = false
+	}
+
+	if p.Dying() && p.Ticks >= p.missAt {
+		p.miss()
+	}
+
+	p.Focused = p.game.frame.Focus
+
+	diff := p.game.frame.move()
+	if p.Focused {
+		diff = diff.Mul(PlayerFocusSpeed / PlayerSpeed)
+	}
+	diff = diff.Add(p.game.frame.drag())
+
+	if !p.Dying() && diff.NormSq() > 0 {
+		p.Pos = p.Pos.Add(diff)
+
+		if p.Pos.X < 0 {
+			p.Pos.X = 0
+		}
+		if p.Pos.X > ScreenWidth {
+			p.Pos.X = ScreenWidth
+		}
+		if p.Pos.Y < 0 {
+			p.Pos.Y = 0
+		}
+		if p.Pos.Y > ScreenHeight {
+			p.Pos.Y = ScreenHeight
+		}
+	}
+
+	if !p.Invincible() && !p.Dying() && p.Life > 0 {
+		p.shoot()
+	}
+
+	p.Ticks++
+
+	return nil
+}
+
+func (p *Player) miss() {
+	p.game.emit(EventMiss, p.Pos, p.R)
+
+	if p.game.OnMiss != nil {
+		p.game.OnMiss()
+	}
+	p.game.clearBulletsAroundHome()
+
+	p.Pos = mathutil.NewVector2D(PlayerHomeX, PlayerHomeY)
+	p.missAt = -1
+	p.invincibleUntil = p.Ticks + 60*3
+	p.Life--
+	p.Power -= missPowerLoss
+	if p.Power < 0 {
+		p.Power = 0
+	}
+	failures := 1
+	for _, e := range p.game.Enemies {
+		if e.State == EnemyStateRunning {
+			e.failuresInBulletMLRunning++
+			if e.failuresInBulletMLRunning > failures {
+				failures = e.failuresInBulletMLRunning
+			}
+		}
+	}
+	p.game.Rank.miss(failures)
+}
+
+type PlayerBullet struct {
+	Pos, prevPos *mathutil.Vector2D
+	v            *mathutil.Vector2D
+	R            float64
+	hit          bool
+}
+
+func (b *PlayerBullet) update() error {
+	b.prevPos = b.Pos.Clone()
+
+	b.Pos = b.Pos.Add(b.v)
+
+	return nil
+}
+
+// Step advances the play by a tick with the input. After the play is over,
+// only the player and its bullets keep moving.
+func (g *Game) Step(frame InputFrame) error {
+	g.frame = frame
+	g.Events = g.Events[:0]
+
+	if g.over {
+		return g.stepOver()
+	}
+
+	return g.step()
+}
+
+func (g *Game) step() error {
+	if err := g.updateStage(); err != nil {
+		return err
+	}
+
+	if g.frame.Bomb {
+		g.Player.bomb()
+	}
+
+	if !g.Player.Invincible() && !g.Player.Dying() {
+		playerTopLeftX := math.Min(g.Player.Pos.X-g.Player.GrazeR, g.Player.prevPos.X-g.Player.GrazeR)
+		playerTopLeftY := math.Min(g.Player.Pos.Y-g.Player.GrazeR, g.Player.prevPos.Y-g.Player.GrazeR)
+		playerBottomRightX := math.Max(g.Player.Pos.X+g.Player.GrazeR, g.Player.prevPos.X+g.Player.GrazeR)
+		playerBottomRightY := math.Max(g.Player.Pos.Y+g.Player.GrazeR, g.Player.prevPos.Y+g.Player.GrazeR)
+		for _, b := range g.Bullets {
+			grazeR := b.R + b.Kind.grazeMargin
+			bulletTopLeftX := math.Min(b.Pos.X-grazeR, b.prevPos.X-grazeR)
+			bulletTopLeftY := math.Min(b.Pos.Y-grazeR, b.prevPos.Y-grazeR)
+			bulletBottomRightX := math.Max(b.Pos.X+grazeR, b.prevPos.X+grazeR)
+			bulletBottomRightY := math.Max(b.Pos.Y+grazeR, b.prevPos.Y+grazeR)
+
+			if bulletTopLeftX > playerBottomRightX ||
+				bulletTopLeftY > playerBottomRightY ||
+				bulletBottomRightX < playerTopLeftX ||
+				bulletBottomRightY < playerTopLeftY {
+				continue
+			}
+
+			if b.collides(g.Player.Pos, g.Player.prevPos, g.Player.GrazeR+b.Kind.grazeMargin) {
+				if !b.grazed {
+					g.Graze++
+					g.addScore(grazeGain)
+
+					b.grazed = true
+
+					g.emit(EventGraze, b.Pos, b.R)
+				}
+
+				if b.collides(g.Player.Pos, g.Player.prevPos, g.Player.R) {
+					b.hit = true
+					g.Player.hit = true
+
+					break
+				}
+			}
+		}
+
+		for _, l := range g.Lasers {
+			if g.Player.hit {
+				break
+			}
+
+			if !l.harmful() || !l.collides(g.Player.Pos, g.Player.prevPos, g.Player.GrazeR+laserGrazeMargin) {
+				continue
+			}
+
+			g.Graze++
+			g.addScore(laserGrazeGain)
+
+			g.emit(EventLaserGraze, g.Player.Pos, g.Player.R)
+
+			if l.collides(g.Player.Pos, g.Player.prevPos, g.Player.R) {
+				g.Player.hit = true
+			}
+		}
+
+		for _, e := range g.Enemies {
+			if e.Alive() && mathutil.CapsulesCollide(
+				g.Player.Pos, g.Player.prevPos.Sub(g.Player.Pos), g.Player.R,
+				e.Pos, e.prevPos.Sub(e.Pos), e.R,
+			) {
+				g.Player.hit = true
+			}
+		}
+	}
+
+	for _, b := range g.PlayerBullets {
+		for _, e := range g.Enemies {
+			if !e.Alive() {
+				continue
+			}
+
+			if mathutil.CapsulesCollide(
+				e.Pos, e.prevPos.Sub(e.Pos), e.R,
+				b.Pos, b.prevPos.Sub(b.Pos), b.R,
+			) {
+				b.hit = true
+				e.hit = true
+
+				g.emit(EventEnemyHit, b.Pos, b.R)
+
+				break
+			}
+		}
+	}
+
+	if err := g.Player.update(); err != nil {
+		return err
+	}
+
+	for _, e := range g.Enemies {
+		if err := e.update(); err != nil {
+			return err
+		}
+	}
+
+	g.Rank.update(g.Graze)
+
+	for i, n := 0, len(g.Bullets); i < n; i++ {
+		if err := g.Bullets[i].update(); err != nil {
+			return err
+		}
+	}
+
+	for i, n := 0, len(g.PlayerBullets); i < n; i++ {
+		if err := g.PlayerBullets[i].update(); err != nil {
+			return err
+		}
+	}
+
+	for i, n := 0, len(g.Items); i < n; i++ {
+		if err := g.Items[i].update(); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range g.Bombs {
+		if err := b.update(); err != nil {
+			return err
+		}
+	}
+
+	for _, l := range g.Lasers {
+		if err := l.update(); err != nil {
+			return err
+		}
+	}
+
+	_bullets := g.Bullets[:0]
+	for _, b := range g.Bullets {
+		if !b.hit &&
+			!b.runner.Vanished() &&
+			b.prevPos.X+b.R > 0 && b.prevPos.X-b.R < ScreenWidth && b.prevPos.Y+b.R > 0 && b.prevPos.Y-b.R < ScreenHeight {
+			_bullets = append(_bullets, b)
+		}
+	}
+	g.Bullets = _bullets
+
+	_lasers := g.Lasers[:0]
+	for _, l := range g.Lasers {
+		if !l.finished {
+			_lasers = append(_lasers, l)
+		}
+	}
+	g.Lasers = _lasers
+
+	_items := g.Items[:0]
+	for _, i := range g.Items {
+		if !i.finished {
+			_items = append(_items, i)
+		}
+	}
+	g.Items = _items
+
+	_bombs := g.Bombs[:0]
+	for _, b := range g.Bombs {
+		if !b.finished {
+			_bombs = append(_bombs, b)
+		}
+	}
+	g.Bombs = _bombs
+
+	_playerBullets := g.PlayerBullets[:0]
+	for _, b := range g.PlayerBullets {
+		if !b.hit &&
+			b.prevPos.X+b.R > 0 && b.prevPos.X-b.R < ScreenWidth && b.prevPos.Y+b.R > 0 && b.prevPos.Y-b.R < ScreenHeight {
+			_playerBullets = append(_playerBullets, b)
+		}
+	}
+	g.PlayerBullets = _playerBullets
+
+	_enemies := g.Enemies[:0]
+	for _, e := range g.Enemies {
+		if e == g.Boss || e.Alive() {
+			_enemies = append(_enemies, e)
+		}
+	}
+	g.Enemies = _enemies
+
+	if g.Player.Life <= 0 || g.Cleared() {
+		g.over = true
+	}
+
+	return nil
+}
+
+func (g *Game) stepOver() error {
+	if err := g.Player.update(); err != nil {
+		return err
+	}
+
+	for i, n := 0, len(g.PlayerBullets); i < n; i++ {
+		if err := g.PlayerBullets[i].update(); err != nil {
+			return err
+		}
+	}
+
+	_playerBullets := g.PlayerBullets[:0]
+	for _, b := range g.PlayerBullets {
+		if !b.hit &&
+			b.prevPos.X+b.R > 0 && b.prevPos.X-b.R < ScreenWidth && b.prevPos.Y+b.R > 0 && b.prevPos.Y-b.R < ScreenHeight {
+			_playerBullets = append(_playerBullets, b)
+		}
+	}
+	g.PlayerBullets = _playerBullets
+
+	return nil
+}
+
+// RestartBarrage restarts the barrages of the file at p being run, removing
+// their bullets. It is used after the file is reloaded. An enemy whose
+// barrage fails to restart idles until it is restarted again, and the first
+// error is returned.
+func (g *Game) RestartBarrage(p string) error {
+	var firstErr error
+	for _, e := range g.Enemies {
+		if e.State == EnemyStateRunning && e.barrages[e.bulletMLIndex].Path == p {
+			e.cancelBullets(false)
+			if err := e.setBulletML(); err != nil {
+				e.runner = nil
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+func (g *Game) clearBulletsAroundHome() {
+	_bullets := g.Bullets[:0]
+	for _, b := range g.Bullets {
+		if b.Pos.Sub(mathutil.NewVector2D(PlayerHomeX, PlayerHomeY)).NormSq() > 300*300 {
+			_bullets = append(_bullets, b)
+		} else {
+			g.emit(EventBulletCanceled, b.Pos, b.R)
+		}
+	}
+	g.Bullets = _bullets
+}
+
+func (g *Game) Cleared() bool {
+	return g.Boss.State == EnemyStateExploded
+}
+
+func (g *Game) updateStage() error {
+	wavesRemaining := false
+	for _, w := range g.stage.Waves {
+		for i := 0; i < w.Count; i++ {
+			at := w.SpawnAt + i*w.Interval
+			if at == g.stageTicks {
+				if err := g.spawnPopcorn(w); err != nil {
+					return err
+				}
+			}
+			if at >= g.stageTicks {
+				wavesRemaining = true
+			}
+		}
+	}
+
+	for _, e := range g.Enemies {
+		if e != g.Boss && e.Alive() {
+			wavesRemaining = true
+		}
+	}
+
+	if !wavesRemaining && !isIn(g.Boss, g.Enemies...) {
+		if len(g.stage.Waves) > 0 {
+			g.Boss.Pos = mathutil.NewVector2D(enemyHomeX, -EnemyR)
+			g.Boss.prevPos = g.Boss.Pos.Clone()
+		}
+		g.Enemies = append(g.Enemies, g.Boss)
+	}
+
+	g.stageTicks++
+
+	return nil
+}
+
+func (g *Game) spawnPopcorn(w *Wave) error {
+	pos := w.Waypoints[0].Clone()
+	e := &Enemy{
+		Pos:           pos,
+		prevPos:       pos.Clone(),
+		R:             popcornR,
+		State:         EnemyStateRunning,
+		Life:          g.enemyLife(w.Barrage),
+		MaxLife:       g.enemyLife(w.Barrage),
+		barrages:      []*Barrage{w.Barrage},
+		waypoints:     w.Waypoints,
+		waypointIndex: 1,
+		speed:         w.Speed,
+		game:          g,
+	}
+
+	if err := e.setBulletML(); err != nil {
+		return err
+	}
+
+	g.Enemies = append(g.Enemies, e)
+
+	return nil
+}
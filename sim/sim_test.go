@@ -0,0 +1,252 @@
+package sim
+
+import (
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func loadTestStage(t *testing.T) *Stage {
+	t.Helper()
+	stage, err := LoadStage(os.DirFS("../resources"), "stage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stage
+}
+
+func TestStep(t *testing.T) {
+	// The boss appears at once without the waves.
+	stage := &Stage{Barrages: loadTestStage(t).Barrages}
+	g := NewGame(stage, Difficulties[1], 1)
+
+	ticks := stage.Barrages[0].Delay + 60
+	for i := 0; i < ticks; i++ {
+		if err := g.Step(InputFrame{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if g.Boss.State != EnemyStateRunning {
+		t.Errorf("boss state: got %v, want %v", g.Boss.State, EnemyStateRunning)
+	}
+	if len(g.Bullets) == 0 {
+		t.Errorf("no bullets after %d ticks", ticks)
+	}
+}
+
+func TestStepNextBarrageWithoutDelay(t *testing.T) {
+	barrages := loadTestStage(t).Barrages
+	first, second := *barrages[0], *barrages[1]
+	first.Delay, first.TimeLimit = 0, 60
+	second.Delay = 0
+	g := NewGame(&Stage{Barrages: []*Barrage{&first, &second}}, Difficulties[1], 1)
+
+	for i := 0; i < 120; i++ {
+		if err := g.Step(InputFrame{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if g.Boss.Barrage() != &second {
+		t.Fatalf("boss is not in the second barrage")
+	}
+	if g.Boss.State != EnemyStateRunning {
+		t.Errorf("boss state: got %v, want %v", g.Boss.State, EnemyStateRunning)
+	}
+}
+
+const waitFirstBulletML = `<?xml version="1.0" ?>
+<bulletml type="vertical" xmlns="http://www.asahi-net.or.jp/~cs8k-cyu/bulletml">
+<action label="top">
+  <wait>10</wait>
+  <fire><bullet/></fire>
+</action>
+</bulletml>`
+
+func loadWaitFirst(t *testing.T) *Barrage {
+	t.Helper()
+	fsys := fstest.MapFS{"wait.xml": {Data: []byte(waitFirstBulletML)}}
+	bml, err := LoadBulletML(fsys, "wait.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Barrage{Path: "wait.xml", EnemyLife: 1, BulletML: bml}
+}
+
+func TestStepBossWithoutBody(t *testing.T) {
+	g := NewGame(&Stage{Barrages: []*Barrage{loadWaitFirst(t)}}, Difficulties[1], 1)
+
+	err := g.Step(InputFrame{})
+	var be *BarrageError
+	if !errors.As(err, &be) || be.Path != "wait.xml" || !errors.Is(err, errNoBody) {
+		t.Errorf("got %v, want %v of wait.xml", err, errNoBody)
+	}
+}
+
+func TestRestartBarrageWithoutBody(t *testing.T) {
+	b := *loadTestStage(t).Barrages[0]
+	b.Delay = 0
+	g := NewGame(&Stage{Barrages: []*Barrage{&b}}, Difficulties[1], 1)
+	for i := 0; i < 10; i++ {
+		if err := g.Step(InputFrame{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.BulletML = loadWaitFirst(t).BulletML
+	if err := g.RestartBarrage(b.Path); !errors.Is(err, errNoBody) {
+		t.Errorf("got %v, want %v", err, errNoBody)
+	}
+
+	// The boss idles without any bullets.
+	for i := 0; i < 10; i++ {
+		if err := g.Step(InputFrame{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(g.Bullets) != 0 {
+		t.Errorf("got %d bullets of the boss idling", len(g.Bullets))
+	}
+}
+
+func TestFocusMovement(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame InputFrame
+		dx    float64
+	}{
+		{"move", InputFrame{MoveX: PlayerSpeed * InputMoveScale}, PlayerSpeed},
+		{"focused move", InputFrame{MoveX: PlayerSpeed * InputMoveScale, Focus: true}, PlayerFocusSpeed},
+		{"drag", InputFrame{DragX: 10 * InputMoveScale}, 10},
+		{"focused drag", InputFrame{DragX: 10 * InputMoveScale, Focus: true}, 10},
+	}
+
+	stage := loadTestStage(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGame(stage, Difficulties[1], 1)
+			if err := g.Step(tt.frame); err != nil {
+				t.Fatal(err)
+			}
+			if dx := g.Player.Pos.X - PlayerHomeX; dx != tt.dx {
+				t.Errorf("got %v, want %v", dx, tt.dx)
+			}
+		})
+	}
+}
+
+// testFrame returns the input of a tick of a scripted run, which sweeps the
+// player from side to side, drags it up and down, focuses from time to time
+// and bombs every 15 seconds.
+func testFrame(tick int) InputFrame {
+	return InputFrame{
+		MoveX: (tick/90%3 - 1) * PlayerSpeed * InputMoveScale,
+		DragY: (tick/200%2*2 - 1) * InputMoveScale / 2,
+		Focus: tick/120%4 == 0,
+		Bomb:  tick%900 == 450,
+	}
+}
+
+// runHashes steps a game with the scripted input for ticks ticks, or until it
+// is over, and returns the state hash after every tick.
+func runHashes(t *testing.T, g *Game, ticks int, frame func(int) InputFrame) []uint64 {
+	t.Helper()
+	var hashes []uint64
+	for i := 0; i < ticks && !g.Over(); i++ {
+		if err := g.Step(frame(i)); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, g.StateHash())
+	}
+	return hashes
+}
+
+func TestStateHashDeterministic(t *testing.T) {
+	stage := loadTestStage(t)
+
+	for _, d := range Difficulties {
+		t.Run(d.Name, func(t *testing.T) {
+			h1 := runHashes(t, NewGame(stage, d, 42), 60*60, testFrame)
+			h2 := runHashes(t, NewGame(stage, d, 42), 60*60, testFrame)
+
+			if len(h1) != len(h2) {
+				t.Fatalf("runs lasted %d and %d ticks", len(h1), len(h2))
+			}
+			for i := range h1 {
+				if h1[i] != h2[i] {
+					t.Fatalf("state hashes differ after tick %d: %x != %x", i+1, h1[i], h2[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStateHashDiffersWithInput(t *testing.T) {
+	stage := loadTestStage(t)
+	d := Difficulties[1]
+
+	h1 := runHashes(t, NewGame(stage, d, 42), 60, testFrame)
+	h2 := runHashes(t, NewGame(stage, d, 42), 60, func(tick int) InputFrame {
+		f := testFrame(tick)
+		if tick == 30 {
+			f.MoveX++
+		}
+		return f
+	})
+
+	for i := range h1 {
+		if i < 30 && h1[i] != h2[i] {
+			t.Fatalf("state hashes differ after tick %d before the input differs", i+1)
+		}
+		if i >= 30 && h1[i] == h2[i] {
+			t.Fatalf("state hashes equal after tick %d after the input differs", i+1)
+		}
+	}
+}
+
+const stillLaserBulletML = `<?xml version="1.0" ?>
+<bulletml type="vertical" xmlns="http://www.asahi-net.or.jp/~cs8k-cyu/bulletml">
+<action label="top">
+  <fire>
+    <speed>0</speed>
+    <bullet>
+      <action>
+        <fire>
+          <direction type="absolute">90</direction>
+          <speed>0</speed>
+          <bullet label="laser"/>
+        </fire>
+        <wait>999</wait>
+      </action>
+    </bullet>
+  </fire>
+</action>
+</bulletml>`
+
+func TestLaserFiredDirection(t *testing.T) {
+	fsys := fstest.MapFS{"laser.xml": {Data: []byte(stillLaserBulletML)}}
+	bml, err := LoadBulletML(fsys, "laser.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	barrage := &Barrage{Path: "laser.xml", EnemyLife: 1, BulletML: bml}
+	g := NewGame(&Stage{Barrages: []*Barrage{barrage}}, Difficulties[1], 1)
+
+	for i := 0; i < 10 && len(g.Lasers) == 0; i++ {
+		if err := g.Step(InputFrame{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(g.Lasers) == 0 {
+		t.Fatal("no lasers")
+	}
+
+	// The laser does not move, so it keeps the direction it is fired in,
+	// to the right, instead of aiming at the player below.
+	if d := g.Lasers[0].Dir; math.Abs(d) > 1e-9 {
+		t.Errorf("laser direction: got %v, want 0", d)
+	}
+}
@@ -0,0 +1,276 @@
+package sim
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/fs"
+	"path"
+
+	"github.com/tsujio/game-util/mathutil"
+	"github.com/tsujio/go-bulletml"
+)
+
+// Stage is the timeline of popcorn waves followed by the ordered list of
+// barrages the boss runs through. Hash is the SHA-256 of the manifest and
+// the barrage files, which identifies the stage a replay was recorded on.
+type Stage struct {
+	Waves    []*Wave
+	Barrages []*Barrage
+	Hash     [sha256.Size]byte
+}
+
+// AllBarrages returns the barrages of the boss and the waves.
+func (s *Stage) AllBarrages() []*Barrage {
+	barrages := append([]*Barrage{}, s.Barrages...)
+	for _, w := range s.Waves {
+		barrages = append(barrages, w.Barrage)
+	}
+	return barrages
+}
+
+// Barrage is a BulletML pattern with the parameters used while it is running.
+// Delay and TimeLimit are in ticks, and a zero TimeLimit means the barrage
+// lasts until the enemy is defeated. The enemy of a Survival barrage can not
+// be damaged and the player wins it by surviving until the time limit.
+type Barrage struct {
+	Title           string
+	File            string
+	Path            string
+	EnemyLife       float64
+	Delay           int
+	TimeLimit       int
+	Survival        bool
+	ClearGain       int
+	ZeroFailureGain int
+	OneFailureGain  int
+	Drops           []*Drop
+	BulletML        *bulletml.BulletML
+}
+
+// Wave is a group of popcorn enemies. Count enemies are spawned every Interval
+// ticks from SpawnAt, the first waypoint, and follow the waypoints at Speed
+// while firing Barrage. They leave the stage at the last waypoint.
+type Wave struct {
+	SpawnAt   int
+	Count     int
+	Interval  int
+	Waypoints []*mathutil.Vector2D
+	Speed     float64
+	Barrage   *Barrage
+}
+
+type dropManifest struct {
+	Item  string `json:"item"`
+	Count int    `json:"count"`
+}
+
+type stageManifest struct {
+	Waves []struct {
+		SpawnAt  int            `json:"spawnAt"`
+		Count    int            `json:"count"`
+		Interval int            `json:"interval"`
+		Path     [][2]float64   `json:"path"`
+		Speed    float64        `json:"speed"`
+		Barrage  string         `json:"barrage"`
+		Life     float64        `json:"life"`
+		Score    int            `json:"score"`
+		Drops    []dropManifest `json:"drops"`
+	} `json:"waves"`
+	Barrages []struct {
+		Title     string  `json:"title"`
+		File      string  `json:"file"`
+		EnemyLife float64 `json:"enemyLife"`
+		Delay     int     `json:"delay"`
+		TimeLimit int     `json:"timeLimit"`
+		Survival  bool    `json:"survival"`
+		Gain      struct {
+			Clear       int `json:"clear"`
+			ZeroFailure int `json:"zeroFailure"`
+			OneFailure  int `json:"oneFailure"`
+		} `json:"gain"`
+		Drops []dropManifest `json:"drops"`
+	} `json:"barrages"`
+}
+
+// LoadStage reads the manifest at manifestPath and the barrage files listed in
+// it. Barrage files are resolved relative to the directory of the manifest.
+func LoadStage(fsys fs.FS, manifestPath string) (*Stage, error) {
+	data, err := fs.ReadFile(fsys, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest stageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+
+	if len(manifest.Barrages) == 0 {
+		return nil, fmt.Errorf("%s: no barrages", manifestPath)
+	}
+
+	h := sha256.New()
+	h.Write(data)
+
+	stage := &Stage{}
+	for i, b := range manifest.Barrages {
+		if b.File == "" {
+			return nil, fmt.Errorf("%s: barrages[%d]: file is required", manifestPath, i)
+		}
+		if b.EnemyLife <= 0 {
+			return nil, fmt.Errorf("%s: barrages[%d]: enemyLife must be positive", manifestPath, i)
+		}
+		if b.Delay < 0 {
+			return nil, fmt.Errorf("%s: barrages[%d]: delay must not be negative", manifestPath, i)
+		}
+		if b.TimeLimit < 0 {
+			return nil, fmt.Errorf("%s: barrages[%d]: timeLimit must not be negative", manifestPath, i)
+		}
+		if b.Survival && b.TimeLimit == 0 {
+			return nil, fmt.Errorf("%s: barrages[%d]: survival barrage requires timeLimit", manifestPath, i)
+		}
+		if b.Gain.Clear < 0 || b.Gain.ZeroFailure < 0 || b.Gain.OneFailure < 0 {
+			return nil, fmt.Errorf("%s: barrages[%d]: gain must not be negative", manifestPath, i)
+		}
+
+		drops, err := loadDrops(b.Drops)
+		if err != nil {
+			return nil, fmt.Errorf("%s: barrages[%d]: %w", manifestPath, i, err)
+		}
+
+		p := path.Join(path.Dir(manifestPath), b.File)
+		bml, err := LoadBulletML(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: barrages[%d]: %w", manifestPath, i, err)
+		}
+		if err := hashFile(h, fsys, p); err != nil {
+			return nil, fmt.Errorf("%s: barrages[%d]: %w", manifestPath, i, err)
+		}
+
+		stage.Barrages = append(stage.Barrages, &Barrage{
+			Title:           b.Title,
+			File:            b.File,
+			Path:            p,
+			EnemyLife:       b.EnemyLife,
+			Delay:           b.Delay,
+			TimeLimit:       b.TimeLimit,
+			Survival:        b.Survival,
+			ClearGain:       b.Gain.Clear,
+			ZeroFailureGain: b.Gain.ZeroFailure,
+			OneFailureGain:  b.Gain.OneFailure,
+			Drops:           drops,
+			BulletML:        bml,
+		})
+	}
+
+	for i, w := range manifest.Waves {
+		if w.SpawnAt < 0 {
+			return nil, fmt.Errorf("%s: waves[%d]: spawnAt must not be negative", manifestPath, i)
+		}
+		if w.Count == 0 {
+			w.Count = 1
+		}
+		if w.Count < 0 {
+			return nil, fmt.Errorf("%s: waves[%d]: count must be positive", manifestPath, i)
+		}
+		if w.Interval < 0 {
+			return nil, fmt.Errorf("%s: waves[%d]: interval must not be negative", manifestPath, i)
+		}
+		if len(w.Path) < 2 {
+			return nil, fmt.Errorf("%s: waves[%d]: path requires at least 2 points", manifestPath, i)
+		}
+		if w.Speed <= 0 {
+			return nil, fmt.Errorf("%s: waves[%d]: speed must be positive", manifestPath, i)
+		}
+		if w.Barrage == "" {
+			return nil, fmt.Errorf("%s: waves[%d]: barrage is required", manifestPath, i)
+		}
+		if w.Life <= 0 {
+			return nil, fmt.Errorf("%s: waves[%d]: life must be positive", manifestPath, i)
+		}
+		if w.Score < 0 {
+			return nil, fmt.Errorf("%s: waves[%d]: score must not be negative", manifestPath, i)
+		}
+
+		drops, err := loadDrops(w.Drops)
+		if err != nil {
+			return nil, fmt.Errorf("%s: waves[%d]: %w", manifestPath, i, err)
+		}
+
+		p := path.Join(path.Dir(manifestPath), w.Barrage)
+		bml, err := LoadBulletML(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: waves[%d]: %w", manifestPath, i, err)
+		}
+		if err := hashFile(h, fsys, p); err != nil {
+			return nil, fmt.Errorf("%s: waves[%d]: %w", manifestPath, i, err)
+		}
+
+		var waypoints []*mathutil.Vector2D
+		for _, pt := range w.Path {
+			waypoints = append(waypoints, mathutil.NewVector2D(pt[0], pt[1]))
+		}
+
+		stage.Waves = append(stage.Waves, &Wave{
+			SpawnAt:   w.SpawnAt,
+			Count:     w.Count,
+			Interval:  w.Interval,
+			Waypoints: waypoints,
+			Speed:     w.Speed,
+			Barrage: &Barrage{
+				File:      w.Barrage,
+				Path:      p,
+				EnemyLife: w.Life,
+				ClearGain: w.Score,
+				Drops:     drops,
+				BulletML:  bml,
+			},
+		})
+	}
+
+	h.Sum(stage.Hash[:0])
+
+	return stage, nil
+}
+
+func hashFile(h hash.Hash, fsys fs.FS, name string) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	h.Write([]byte(name))
+	h.Write(data)
+	return nil
+}
+
+func loadDrops(manifests []dropManifest) ([]*Drop, error) {
+	var drops []*Drop
+	for i, d := range manifests {
+		kind, exists := itemKindNames[d.Item]
+		if !exists {
+			return nil, fmt.Errorf("drops[%d]: unknown item %q", i, d.Item)
+		}
+		if d.Count <= 0 {
+			return nil, fmt.Errorf("drops[%d]: count must be positive", i)
+		}
+		drops = append(drops, &Drop{Kind: kind, Count: d.Count})
+	}
+	return drops, nil
+}
+
+func LoadBulletML(fsys fs.FS, name string) (*bulletml.BulletML, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bml, err := bulletml.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return bml, nil
+}
@@ -0,0 +1,39 @@
+//go:build !js
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// loadData reads the named data saved in the user config directory. It
+// returns nil data if nothing is saved.
+func loadData(name string) ([]byte, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, gameName, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func saveData(name string, data []byte) error {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+
+	dir = filepath.Join(dir, gameName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
@@ -0,0 +1,23 @@
+//go:build js
+
+package main
+
+import (
+	"encoding/base64"
+	"syscall/js"
+)
+
+// loadData reads the named data saved in base64 in the local storage of the
+// browser. It returns nil data if nothing is saved.
+func loadData(name string) ([]byte, error) {
+	v := js.Global().Get("localStorage").Call("getItem", gameName+"/"+name)
+	if v.IsNull() {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(v.String())
+}
+
+func saveData(name string, data []byte) error {
+	js.Global().Get("localStorage").Call("setItem", gameName+"/"+name, base64.StdEncoding.EncodeToString(data))
+	return nil
+}
@@ -0,0 +1,194 @@
+package touchutil
+
+import (
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+const gamepadDeadZone = 0.25
+
+// MoveBinding is the keys and standard gamepad buttons which move the touches
+// of the keyboard and gamepads in Dir.
+type MoveBinding struct {
+	Dir            *mathutil.Vector2D
+	Keys           []ebiten.Key
+	GamepadButtons []ebiten.StandardGamepadButton
+}
+
+// DefaultMoveBindings returns the bindings of the arrow keys, WASD and the
+// d-pad.
+func DefaultMoveBindings() []MoveBinding {
+	return []MoveBinding{
+		{
+			Dir:            mathutil.NewVector2D(0, -1),
+			Keys:           []ebiten.Key{ebiten.KeyArrowUp, ebiten.KeyW},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftTop},
+		},
+		{
+			Dir:            mathutil.NewVector2D(0, 1),
+			Keys:           []ebiten.Key{ebiten.KeyArrowDown, ebiten.KeyS},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftBottom},
+		},
+		{
+			Dir:            mathutil.NewVector2D(-1, 0),
+			Keys:           []ebiten.Key{ebiten.KeyArrowLeft, ebiten.KeyA},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftLeft},
+		},
+		{
+			Dir:            mathutil.NewVector2D(1, 0),
+			Keys:           []ebiten.Key{ebiten.KeyArrowRight, ebiten.KeyD},
+			GamepadButtons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftRight},
+		},
+	}
+}
+
+// SetMoveBindings replaces the bindings which move the touches of the
+// keyboard and gamepads.
+func (tr *Tracker) SetMoveBindings(bindings []MoveBinding) {
+	tr.moveBindings = bindings
+}
+
+// appendDeviceTouches appends a touch for the keyboard or a gamepad whose
+// direction starts being held. The touch moves by the move speed of the
+// tracker per tick while its direction is fully held. Gamepads connected or
+// disconnected while the game runs are followed.
+func (tr *Tracker) appendDeviceTouches(touches []Touch) []Touch {
+	src := tr.src
+
+	held := tr.keyboardDirection().NormSq() > 0
+	if held && !tr.keyboardHeld {
+		touches = append(touches, &keyboardMove{virtualMove: virtualMove{tracker: tr}})
+	}
+	tr.keyboardHeld = held
+
+	tr.justGamepadIDs = src.AppendJustConnectedGamepadIDs(tr.justGamepadIDs[:0])
+	for _, id := range tr.justGamepadIDs {
+		delete(tr.gamepadsHeld, id)
+	}
+
+	tr.gamepadIDs = src.AppendGamepadIDs(tr.gamepadIDs[:0])
+	for id := range tr.gamepadsHeld {
+		if src.IsGamepadJustDisconnected(id) {
+			delete(tr.gamepadsHeld, id)
+		}
+	}
+	for _, id := range tr.gamepadIDs {
+		held := tr.gamepadDirection(id).NormSq() > 0
+		if held && !tr.gamepadsHeld[id] {
+			touches = append(touches, &gamepadMove{virtualMove: virtualMove{tracker: tr}, id: id})
+		}
+		tr.gamepadsHeld[id] = held
+	}
+
+	return touches
+}
+
+func (tr *Tracker) keyboardDirection() *mathutil.Vector2D {
+	v := mathutil.NewVector2D(0, 0)
+	for _, b := range tr.moveBindings {
+		for _, k := range b.Keys {
+			if tr.src.IsKeyPressed(k) {
+				v = v.Add(b.Dir)
+				break
+			}
+		}
+	}
+	return clampNorm(v)
+}
+
+func (tr *Tracker) gamepadDirection(id ebiten.GamepadID) *mathutil.Vector2D {
+	src := tr.src
+
+	v := mathutil.NewVector2D(0, 0)
+	if !src.IsStandardGamepadLayoutAvailable(id) {
+		return v
+	}
+
+	for _, b := range tr.moveBindings {
+		for _, btn := range b.GamepadButtons {
+			if src.IsStandardGamepadButtonPressed(id, btn) {
+				v = v.Add(b.Dir)
+				break
+			}
+		}
+	}
+
+	x := src.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+	y := src.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+	if math.Hypot(x, y) > gamepadDeadZone {
+		v = v.Add(mathutil.NewVector2D(x, y))
+	}
+
+	return clampNorm(v)
+}
+
+func clampNorm(v *mathutil.Vector2D) *mathutil.Vector2D {
+	if n := v.Norm(); n > 1 {
+		return v.Div(n)
+	}
+	return v
+}
+
+// virtualMove is a touch dragged from the origin by a direction input.
+type virtualMove struct {
+	ticks        int
+	pos, prevPos *mathutil.Vector2D
+	tracker      *Tracker
+}
+
+func (v *virtualMove) move(dir *mathutil.Vector2D) {
+	if v.pos != nil {
+		v.prevPos = v.pos.Clone()
+		v.pos = v.pos.Add(dir.Mul(v.tracker.moveSpeed))
+	} else {
+		v.pos = mathutil.NewVector2D(0, 0)
+	}
+	v.ticks++
+}
+
+func (v *virtualMove) IsJustTouched() bool {
+	return v.ticks == 1
+}
+
+func (v *virtualMove) Position() *mathutil.Vector2D {
+	return v.pos
+}
+
+func (v *virtualMove) PreviousPosition() *mathutil.Vector2D {
+	return v.prevPos
+}
+
+type keyboardMove struct {
+	virtualMove
+}
+
+func (k *keyboardMove) Update() {
+	k.move(k.tracker.keyboardDirection())
+}
+
+func (k *keyboardMove) ID() TouchID {
+	return TouchID{touchType: TouchTypeKeyboard}
+}
+
+func (k *keyboardMove) IsJustReleased() bool {
+	return k.tracker.keyboardDirection().NormSq() == 0
+}
+
+type gamepadMove struct {
+	virtualMove
+	id ebiten.GamepadID
+}
+
+func (g *gamepadMove) Update() {
+	g.move(g.tracker.gamepadDirection(g.id))
+}
+
+func (g *gamepadMove) ID() TouchID {
+	return TouchID{touchType: TouchTypeGamepad, apiID: g.id}
+}
+
+func (g *gamepadMove) IsJustReleased() bool {
+	return g.tracker.src.IsGamepadJustDisconnected(g.id) || g.tracker.gamepadDirection(g.id).NormSq() == 0
+}
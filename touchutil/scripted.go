@@ -0,0 +1,215 @@
+package touchutil
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// ScriptedTouch is a finger on the screen in a ScriptedFrame. A touch with
+// the same ID in consecutive frames is the same finger.
+type ScriptedTouch struct {
+	ID   int
+	X, Y int
+}
+
+// ScriptedMouse is the cursor and the pressed buttons of the mouse in a
+// ScriptedFrame.
+type ScriptedMouse struct {
+	X, Y    int
+	Buttons []ebiten.MouseButton
+}
+
+// ScriptedGamepad is a gamepad with the standard layout connected in a
+// ScriptedFrame. A gamepad with the same ID in consecutive frames is the same
+// gamepad, and it is disconnected in the first frame without it.
+type ScriptedGamepad struct {
+	ID      int
+	Buttons []ebiten.StandardGamepadButton
+	Axes    map[ebiten.StandardGamepadAxis]float64
+}
+
+// ScriptedFrame is the state of the devices in a tick.
+type ScriptedFrame struct {
+	Touches  []ScriptedTouch
+	Keys     []ebiten.Key
+	Mouse    ScriptedMouse
+	Gamepads []ScriptedGamepad
+}
+
+// ScriptedSource feeds a frame per tick, for tests, bots and replays. Frames
+// can be appended while the source is in use, and every device is released
+// after the last frame.
+type ScriptedSource struct {
+	frames []ScriptedFrame
+	tick   int
+}
+
+func NewScriptedSource(frames []ScriptedFrame) *ScriptedSource {
+	return &ScriptedSource{
+		frames: frames,
+		tick:   -1,
+	}
+}
+
+// Push appends a frame to be fed after the existing ones.
+func (s *ScriptedSource) Push(f ScriptedFrame) {
+	s.frames = append(s.frames, f)
+}
+
+// Tick returns the index of the current frame.
+func (s *ScriptedSource) Tick() int {
+	return s.tick
+}
+
+func (s *ScriptedSource) frame(tick int) *ScriptedFrame {
+	if tick < 0 || tick >= len(s.frames) {
+		return &ScriptedFrame{}
+	}
+	return &s.frames[tick]
+}
+
+func (f *ScriptedFrame) touch(id ebiten.TouchID) *ScriptedTouch {
+	for i := range f.Touches {
+		if ebiten.TouchID(f.Touches[i].ID) == id {
+			return &f.Touches[i]
+		}
+	}
+	return nil
+}
+
+func (f *ScriptedFrame) keyPressed(key ebiten.Key) bool {
+	return isIn(key, f.Keys...)
+}
+
+func (f *ScriptedFrame) mouseButtonPressed(button ebiten.MouseButton) bool {
+	return isIn(button, f.Mouse.Buttons...)
+}
+
+func (f *ScriptedFrame) gamepad(id ebiten.GamepadID) *ScriptedGamepad {
+	for i := range f.Gamepads {
+		if ebiten.GamepadID(f.Gamepads[i].ID) == id {
+			return &f.Gamepads[i]
+		}
+	}
+	return nil
+}
+
+func (f *ScriptedFrame) gamepadButtonPressed(id ebiten.GamepadID, button ebiten.StandardGamepadButton) bool {
+	g := f.gamepad(id)
+	return g != nil && isIn(button, g.Buttons...)
+}
+
+func isIn[T comparable](v T, values ...T) bool {
+	for _, val := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScriptedSource) Update() {
+	s.tick++
+}
+
+func (s *ScriptedSource) IsMouseButtonJustPressed(button ebiten.MouseButton) bool {
+	return s.frame(s.tick).mouseButtonPressed(button) && !s.frame(s.tick-1).mouseButtonPressed(button)
+}
+
+func (s *ScriptedSource) IsMouseButtonJustReleased(button ebiten.MouseButton) bool {
+	return !s.frame(s.tick).mouseButtonPressed(button) && s.frame(s.tick-1).mouseButtonPressed(button)
+}
+
+func (s *ScriptedSource) CursorPosition() (int, int) {
+	m := s.frame(s.tick).Mouse
+	return m.X, m.Y
+}
+
+func (s *ScriptedSource) AppendJustPressedTouchIDs(ids []ebiten.TouchID) []ebiten.TouchID {
+	prev := s.frame(s.tick - 1)
+	for _, t := range s.frame(s.tick).Touches {
+		if prev.touch(ebiten.TouchID(t.ID)) == nil {
+			ids = append(ids, ebiten.TouchID(t.ID))
+		}
+	}
+	return ids
+}
+
+func (s *ScriptedSource) IsTouchJustReleased(id ebiten.TouchID) bool {
+	return s.frame(s.tick).touch(id) == nil && s.frame(s.tick-1).touch(id) != nil
+}
+
+func (s *ScriptedSource) TouchPosition(id ebiten.TouchID) (int, int) {
+	if t := s.frame(s.tick).touch(id); t != nil {
+		return t.X, t.Y
+	}
+	return 0, 0
+}
+
+func (s *ScriptedSource) TouchPositionInPreviousTick(id ebiten.TouchID) (int, int) {
+	if t := s.frame(s.tick - 1).touch(id); t != nil {
+		return t.X, t.Y
+	}
+	return 0, 0
+}
+
+func (s *ScriptedSource) IsKeyPressed(key ebiten.Key) bool {
+	return s.frame(s.tick).keyPressed(key)
+}
+
+func (s *ScriptedSource) AppendJustPressedKeys(keys []ebiten.Key) []ebiten.Key {
+	prev := s.frame(s.tick - 1)
+	for _, k := range s.frame(s.tick).Keys {
+		if !prev.keyPressed(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *ScriptedSource) AppendGamepadIDs(ids []ebiten.GamepadID) []ebiten.GamepadID {
+	for _, g := range s.frame(s.tick).Gamepads {
+		ids = append(ids, ebiten.GamepadID(g.ID))
+	}
+	return ids
+}
+
+func (s *ScriptedSource) AppendJustConnectedGamepadIDs(ids []ebiten.GamepadID) []ebiten.GamepadID {
+	prev := s.frame(s.tick - 1)
+	for _, g := range s.frame(s.tick).Gamepads {
+		if prev.gamepad(ebiten.GamepadID(g.ID)) == nil {
+			ids = append(ids, ebiten.GamepadID(g.ID))
+		}
+	}
+	return ids
+}
+
+func (s *ScriptedSource) IsGamepadJustDisconnected(id ebiten.GamepadID) bool {
+	return s.frame(s.tick).gamepad(id) == nil && s.frame(s.tick-1).gamepad(id) != nil
+}
+
+func (s *ScriptedSource) IsStandardGamepadLayoutAvailable(id ebiten.GamepadID) bool {
+	return s.frame(s.tick).gamepad(id) != nil
+}
+
+func (s *ScriptedSource) IsStandardGamepadButtonPressed(id ebiten.GamepadID, button ebiten.StandardGamepadButton) bool {
+	return s.frame(s.tick).gamepadButtonPressed(id, button)
+}
+
+func (s *ScriptedSource) AppendJustPressedStandardGamepadButtons(id ebiten.GamepadID, buttons []ebiten.StandardGamepadButton) []ebiten.StandardGamepadButton {
+	prev := s.frame(s.tick - 1)
+	if g := s.frame(s.tick).gamepad(id); g != nil {
+		for _, b := range g.Buttons {
+			if !prev.gamepadButtonPressed(id, b) {
+				buttons = append(buttons, b)
+			}
+		}
+	}
+	return buttons
+}
+
+func (s *ScriptedSource) StandardGamepadAxisValue(id ebiten.GamepadID, axis ebiten.StandardGamepadAxis) float64 {
+	if g := s.frame(s.tick).gamepad(id); g != nil {
+		return g.Axes[axis]
+	}
+	return 0
+}
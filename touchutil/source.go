@@ -0,0 +1,101 @@
+package touchutil
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// InputSource is the device state touches are read from. Update is called
+// once per tick by Tracker.AppendNewTouches before any other method.
+type InputSource interface {
+	Update()
+
+	IsMouseButtonJustPressed(button ebiten.MouseButton) bool
+	IsMouseButtonJustReleased(button ebiten.MouseButton) bool
+	CursorPosition() (int, int)
+
+	AppendJustPressedTouchIDs(ids []ebiten.TouchID) []ebiten.TouchID
+	IsTouchJustReleased(id ebiten.TouchID) bool
+	TouchPosition(id ebiten.TouchID) (int, int)
+	TouchPositionInPreviousTick(id ebiten.TouchID) (int, int)
+
+	IsKeyPressed(key ebiten.Key) bool
+	AppendJustPressedKeys(keys []ebiten.Key) []ebiten.Key
+
+	AppendGamepadIDs(ids []ebiten.GamepadID) []ebiten.GamepadID
+	AppendJustConnectedGamepadIDs(ids []ebiten.GamepadID) []ebiten.GamepadID
+	IsGamepadJustDisconnected(id ebiten.GamepadID) bool
+	IsStandardGamepadLayoutAvailable(id ebiten.GamepadID) bool
+	IsStandardGamepadButtonPressed(id ebiten.GamepadID, button ebiten.StandardGamepadButton) bool
+	AppendJustPressedStandardGamepadButtons(id ebiten.GamepadID, buttons []ebiten.StandardGamepadButton) []ebiten.StandardGamepadButton
+	StandardGamepadAxisValue(id ebiten.GamepadID, axis ebiten.StandardGamepadAxis) float64
+}
+
+// EbitenSource reads the devices through ebiten.
+type EbitenSource struct{}
+
+func (EbitenSource) Update() {}
+
+func (EbitenSource) IsMouseButtonJustPressed(button ebiten.MouseButton) bool {
+	return inpututil.IsMouseButtonJustPressed(button)
+}
+
+func (EbitenSource) IsMouseButtonJustReleased(button ebiten.MouseButton) bool {
+	return inpututil.IsMouseButtonJustReleased(button)
+}
+
+func (EbitenSource) CursorPosition() (int, int) {
+	return ebiten.CursorPosition()
+}
+
+func (EbitenSource) AppendJustPressedTouchIDs(ids []ebiten.TouchID) []ebiten.TouchID {
+	return inpututil.AppendJustPressedTouchIDs(ids)
+}
+
+func (EbitenSource) IsTouchJustReleased(id ebiten.TouchID) bool {
+	return inpututil.IsTouchJustReleased(id)
+}
+
+func (EbitenSource) TouchPosition(id ebiten.TouchID) (int, int) {
+	return ebiten.TouchPosition(id)
+}
+
+func (EbitenSource) TouchPositionInPreviousTick(id ebiten.TouchID) (int, int) {
+	return inpututil.TouchPositionInPreviousTick(id)
+}
+
+func (EbitenSource) IsKeyPressed(key ebiten.Key) bool {
+	return ebiten.IsKeyPressed(key)
+}
+
+func (EbitenSource) AppendJustPressedKeys(keys []ebiten.Key) []ebiten.Key {
+	return inpututil.AppendJustPressedKeys(keys)
+}
+
+func (EbitenSource) AppendGamepadIDs(ids []ebiten.GamepadID) []ebiten.GamepadID {
+	return ebiten.AppendGamepadIDs(ids)
+}
+
+func (EbitenSource) AppendJustConnectedGamepadIDs(ids []ebiten.GamepadID) []ebiten.GamepadID {
+	return inpututil.AppendJustConnectedGamepadIDs(ids)
+}
+
+func (EbitenSource) IsGamepadJustDisconnected(id ebiten.GamepadID) bool {
+	return inpututil.IsGamepadJustDisconnected(id)
+}
+
+func (EbitenSource) IsStandardGamepadLayoutAvailable(id ebiten.GamepadID) bool {
+	return ebiten.IsStandardGamepadLayoutAvailable(id)
+}
+
+func (EbitenSource) IsStandardGamepadButtonPressed(id ebiten.GamepadID, button ebiten.StandardGamepadButton) bool {
+	return ebiten.IsStandardGamepadButtonPressed(id, button)
+}
+
+func (EbitenSource) AppendJustPressedStandardGamepadButtons(id ebiten.GamepadID, buttons []ebiten.StandardGamepadButton) []ebiten.StandardGamepadButton {
+	return inpututil.AppendJustPressedStandardGamepadButtons(id, buttons)
+}
+
+func (EbitenSource) StandardGamepadAxisValue(id ebiten.GamepadID, axis ebiten.StandardGamepadAxis) float64 {
+	return ebiten.StandardGamepadAxisValue(id, axis)
+}
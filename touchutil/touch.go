@@ -2,28 +2,69 @@ package touchutil
 
 import (
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/tsujio/game-util/mathutil"
 )
 
-var (
-	justScreenTouchedIDs = make([]ebiten.TouchID, 0)
-)
+// Tracker produces the touches of an InputSource. The state of the devices
+// between ticks is kept in the tracker, so trackers of different sources can
+// be used together.
+type Tracker struct {
+	src                  InputSource
+	moveSpeed            float64
+	moveBindings         []MoveBinding
+	justScreenTouchedIDs []ebiten.TouchID
+	keyboardHeld         bool
+	gamepadIDs           []ebiten.GamepadID
+	gamepadsHeld         map[ebiten.GamepadID]bool
+	justGamepadIDs       []ebiten.GamepadID
+}
+
+// NewTracker returns a tracker of src. Touches of the keyboard and gamepads
+// move by moveSpeed per tick, with DefaultMoveBindings until SetMoveBindings.
+func NewTracker(src InputSource, moveSpeed float64) *Tracker {
+	return &Tracker{
+		src:          src,
+		moveSpeed:    moveSpeed,
+		moveBindings: DefaultMoveBindings(),
+		gamepadsHeld: make(map[ebiten.GamepadID]bool),
+	}
+}
+
+func (tr *Tracker) Source() InputSource {
+	return tr.src
+}
+
+// Reset forgets the directions held on the keyboard and gamepads, so that
+// new touches are produced for the ones still held after the caller drops
+// its touches.
+func (tr *Tracker) Reset() {
+	tr.keyboardHeld = false
+	for id := range tr.gamepadsHeld {
+		delete(tr.gamepadsHeld, id)
+	}
+}
+
+// AppendNewTouches appends the touches started in this tick.
+func (tr *Tracker) AppendNewTouches(touches []Touch) []Touch {
+	tr.src.Update()
 
-func AppendNewTouches(touches []Touch) []Touch {
-	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+	if tr.src.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		touches = append(touches, &mouseButtonPress{
-			id: ebiten.MouseButtonLeft,
+			id:  ebiten.MouseButtonLeft,
+			src: tr.src,
 		})
 	}
 
-	justScreenTouchedIDs = inpututil.AppendJustPressedTouchIDs(justScreenTouchedIDs[:0])
-	for _, id := range justScreenTouchedIDs {
+	tr.justScreenTouchedIDs = tr.src.AppendJustPressedTouchIDs(tr.justScreenTouchedIDs[:0])
+	for _, id := range tr.justScreenTouchedIDs {
 		touches = append(touches, &screenTouch{
-			id: id,
+			id:      id,
+			tracker: tr,
 		})
 	}
 
+	touches = tr.appendDeviceTouches(touches)
+
 	return touches
 }
 
@@ -32,6 +73,8 @@ type TouchType int
 const (
 	TouchTypeMouseButtonPress = iota
 	TouchTypeScreenTouch
+	TouchTypeKeyboard
+	TouchTypeGamepad
 )
 
 type TouchID struct {
@@ -39,6 +82,10 @@ type TouchID struct {
 	apiID     any
 }
 
+func (id TouchID) Type() TouchType {
+	return id.touchType
+}
+
 type Touch interface {
 	Update()
 	ID() TouchID
@@ -51,13 +98,14 @@ type Touch interface {
 type mouseButtonPress struct {
 	id           ebiten.MouseButton
 	pos, prevPos *mathutil.Vector2D
+	src          InputSource
 }
 
 func (m *mouseButtonPress) Update() {
 	if m.pos != nil {
 		m.prevPos = m.pos.Clone()
 	}
-	x, y := ebiten.CursorPosition()
+	x, y := m.src.CursorPosition()
 	m.pos = mathutil.NewVector2D(float64(x), float64(y))
 }
 
@@ -66,11 +114,11 @@ func (m *mouseButtonPress) ID() TouchID {
 }
 
 func (m *mouseButtonPress) IsJustTouched() bool {
-	return inpututil.IsMouseButtonJustPressed(m.id)
+	return m.src.IsMouseButtonJustPressed(m.id)
 }
 
 func (m *mouseButtonPress) IsJustReleased() bool {
-	return inpututil.IsMouseButtonJustReleased(m.id)
+	return m.src.IsMouseButtonJustReleased(m.id)
 }
 
 func (m *mouseButtonPress) Position() *mathutil.Vector2D {
@@ -84,6 +132,7 @@ func (m *mouseButtonPress) PreviousPosition() *mathutil.Vector2D {
 type screenTouch struct {
 	id           ebiten.TouchID
 	pos, prevPos *mathutil.Vector2D
+	tracker      *Tracker
 }
 
 func (s *screenTouch) Update() {
@@ -92,9 +141,9 @@ func (s *screenTouch) Update() {
 	}
 	var x, y int
 	if s.IsJustReleased() {
-		x, y = inpututil.TouchPositionInPreviousTick(s.id)
+		x, y = s.tracker.src.TouchPositionInPreviousTick(s.id)
 	} else {
-		x, y = ebiten.TouchPosition(s.id)
+		x, y = s.tracker.src.TouchPosition(s.id)
 	}
 	s.pos = mathutil.NewVector2D(float64(x), float64(y))
 }
@@ -104,7 +153,7 @@ func (s *screenTouch) ID() TouchID {
 }
 
 func (s *screenTouch) IsJustTouched() bool {
-	for _, id := range justScreenTouchedIDs {
+	for _, id := range s.tracker.justScreenTouchedIDs {
 		if id == s.id {
 			return true
 		}
@@ -113,7 +162,7 @@ func (s *screenTouch) IsJustTouched() bool {
 }
 
 func (s *screenTouch) IsJustReleased() bool {
-	return inpututil.IsTouchJustReleased(s.id)
+	return s.tracker.src.IsTouchJustReleased(s.id)
 }
 
 func (s *screenTouch) Position() *mathutil.Vector2D {
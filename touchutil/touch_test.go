@@ -0,0 +1,243 @@
+package touchutil
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/tsujio/game-util/mathutil"
+)
+
+type touchState struct {
+	typ          TouchType
+	x, y         float64
+	justTouched  bool
+	justReleased bool
+}
+
+// runTracker feeds the frames to a tracker as the game loop does, and returns
+// the states of the touches alive in every tick.
+func runTracker(frames []ScriptedFrame, moveSpeed float64) [][]touchState {
+	tr := NewTracker(NewScriptedSource(frames), moveSpeed)
+
+	var (
+		touches []Touch
+		states  [][]touchState
+	)
+	for range frames {
+		touches = tr.AppendNewTouches(touches)
+
+		var s []touchState
+		for _, t := range touches {
+			t.Update()
+			s = append(s, touchState{
+				typ:          t.ID().Type(),
+				x:            t.Position().X,
+				y:            t.Position().Y,
+				justTouched:  t.IsJustTouched(),
+				justReleased: t.IsJustReleased(),
+			})
+		}
+		states = append(states, s)
+
+		_touches := touches[:0]
+		for _, t := range touches {
+			if !t.IsJustReleased() {
+				_touches = append(_touches, t)
+			}
+		}
+		touches = _touches
+	}
+
+	return states
+}
+
+func TestTracker(t *testing.T) {
+	diag := 4 / math.Sqrt2
+
+	tests := []struct {
+		name     string
+		frames   []ScriptedFrame
+		expected [][]touchState
+	}{
+		{
+			name: "screen touch",
+			frames: []ScriptedFrame{
+				{Touches: []ScriptedTouch{{ID: 1, X: 10, Y: 20}}},
+				{Touches: []ScriptedTouch{{ID: 1, X: 15, Y: 25}}},
+				{},
+			},
+			expected: [][]touchState{
+				{{typ: TouchTypeScreenTouch, x: 10, y: 20, justTouched: true}},
+				{{typ: TouchTypeScreenTouch, x: 15, y: 25}},
+				{{typ: TouchTypeScreenTouch, x: 15, y: 25, justReleased: true}},
+			},
+		},
+		{
+			name: "second finger",
+			frames: []ScriptedFrame{
+				{Touches: []ScriptedTouch{{ID: 1, X: 10, Y: 20}}},
+				{Touches: []ScriptedTouch{{ID: 1, X: 10, Y: 20}, {ID: 2, X: 50, Y: 60}}},
+				{Touches: []ScriptedTouch{{ID: 1, X: 10, Y: 20}}},
+			},
+			expected: [][]touchState{
+				{{typ: TouchTypeScreenTouch, x: 10, y: 20, justTouched: true}},
+				{{typ: TouchTypeScreenTouch, x: 10, y: 20}, {typ: TouchTypeScreenTouch, x: 50, y: 60, justTouched: true}},
+				{{typ: TouchTypeScreenTouch, x: 10, y: 20}, {typ: TouchTypeScreenTouch, x: 50, y: 60, justReleased: true}},
+			},
+		},
+		{
+			name: "mouse drag",
+			frames: []ScriptedFrame{
+				{Mouse: ScriptedMouse{X: 5, Y: 5}},
+				{Mouse: ScriptedMouse{X: 5, Y: 5, Buttons: []ebiten.MouseButton{ebiten.MouseButtonLeft}}},
+				{Mouse: ScriptedMouse{X: 8, Y: 9, Buttons: []ebiten.MouseButton{ebiten.MouseButtonLeft}}},
+				{Mouse: ScriptedMouse{X: 8, Y: 9}},
+			},
+			expected: [][]touchState{
+				nil,
+				{{typ: TouchTypeMouseButtonPress, x: 5, y: 5, justTouched: true}},
+				{{typ: TouchTypeMouseButtonPress, x: 8, y: 9}},
+				{{typ: TouchTypeMouseButtonPress, x: 8, y: 9, justReleased: true}},
+			},
+		},
+		{
+			name: "key hold and release",
+			frames: []ScriptedFrame{
+				{Keys: []ebiten.Key{ebiten.KeyArrowRight}},
+				{Keys: []ebiten.Key{ebiten.KeyArrowRight}},
+				{Keys: []ebiten.Key{ebiten.KeyArrowRight, ebiten.KeyArrowDown}},
+				{},
+				{Keys: []ebiten.Key{ebiten.KeyA}},
+			},
+			expected: [][]touchState{
+				{{typ: TouchTypeKeyboard, x: 0, y: 0, justTouched: true}},
+				{{typ: TouchTypeKeyboard, x: 4, y: 0}},
+				{{typ: TouchTypeKeyboard, x: 4 + diag, y: diag}},
+				{{typ: TouchTypeKeyboard, x: 4 + diag, y: diag, justReleased: true}},
+				{{typ: TouchTypeKeyboard, x: 0, y: 0, justTouched: true}},
+			},
+		},
+		{
+			name: "gamepad d-pad and disconnection",
+			frames: []ScriptedFrame{
+				{Gamepads: []ScriptedGamepad{{ID: 0}}},
+				{Gamepads: []ScriptedGamepad{{ID: 0, Buttons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftRight}}}},
+				{Gamepads: []ScriptedGamepad{{ID: 0, Buttons: []ebiten.StandardGamepadButton{ebiten.StandardGamepadButtonLeftRight}}}},
+				{},
+			},
+			expected: [][]touchState{
+				nil,
+				{{typ: TouchTypeGamepad, x: 0, y: 0, justTouched: true}},
+				{{typ: TouchTypeGamepad, x: 4, y: 0}},
+				{{typ: TouchTypeGamepad, x: 4, y: 0, justReleased: true}},
+			},
+		},
+		{
+			name: "gamepad stick",
+			frames: []ScriptedFrame{
+				{Gamepads: []ScriptedGamepad{{ID: 3, Axes: map[ebiten.StandardGamepadAxis]float64{ebiten.StandardGamepadAxisLeftStickVertical: 0.1}}}},
+				{Gamepads: []ScriptedGamepad{{ID: 3, Axes: map[ebiten.StandardGamepadAxis]float64{ebiten.StandardGamepadAxisLeftStickVertical: 0.5}}}},
+				{Gamepads: []ScriptedGamepad{{ID: 3, Axes: map[ebiten.StandardGamepadAxis]float64{ebiten.StandardGamepadAxisLeftStickVertical: 0.5}}}},
+				{Gamepads: []ScriptedGamepad{{ID: 3}}},
+			},
+			expected: [][]touchState{
+				nil,
+				{{typ: TouchTypeGamepad, x: 0, y: 0, justTouched: true}},
+				{{typ: TouchTypeGamepad, x: 0, y: 2}},
+				{{typ: TouchTypeGamepad, x: 0, y: 2, justReleased: true}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := runTracker(tt.frames, 4)
+			for tick, expected := range tt.expected {
+				got := states[tick]
+				if len(got) != len(expected) {
+					t.Fatalf("tick %d: got %d touches, want %d", tick, len(got), len(expected))
+				}
+				for i, e := range expected {
+					g := got[i]
+					if g.typ != e.typ || g.justTouched != e.justTouched || g.justReleased != e.justReleased ||
+						math.Abs(g.x-e.x) > 1e-9 || math.Abs(g.y-e.y) > 1e-9 {
+						t.Errorf("tick %d, touch %d: got %+v, want %+v", tick, i, g, e)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTrackersAreIndependent(t *testing.T) {
+	tr1 := NewTracker(NewScriptedSource([]ScriptedFrame{
+		{Touches: []ScriptedTouch{{ID: 1, X: 10, Y: 20}}},
+	}), 4)
+	tr2 := NewTracker(NewScriptedSource([]ScriptedFrame{
+		{Keys: []ebiten.Key{ebiten.KeyArrowUp}},
+	}), 4)
+
+	touches1 := tr1.AppendNewTouches(nil)
+	touches2 := tr2.AppendNewTouches(nil)
+
+	if len(touches1) != 1 || len(touches2) != 1 {
+		t.Fatalf("got %d and %d touches, want 1 and 1", len(touches1), len(touches2))
+	}
+
+	touches1[0].Update()
+	if !touches1[0].IsJustTouched() {
+		t.Errorf("touch of the first tracker is not just touched after the second tracker updates")
+	}
+	if typ := touches2[0].ID().Type(); typ != TouchTypeKeyboard {
+		t.Errorf("touch of the second tracker: got type %v, want %v", typ, TouchTypeKeyboard)
+	}
+}
+
+func TestTrackerMoveBindings(t *testing.T) {
+	tr := NewTracker(NewScriptedSource([]ScriptedFrame{
+		{Keys: []ebiten.Key{ebiten.KeyArrowRight}},
+		{Keys: []ebiten.Key{ebiten.KeyL}},
+		{Keys: []ebiten.Key{ebiten.KeyL}},
+	}), 4)
+	tr.SetMoveBindings([]MoveBinding{
+		{Dir: mathutil.NewVector2D(1, 0), Keys: []ebiten.Key{ebiten.KeyL}},
+	})
+
+	if touches := tr.AppendNewTouches(nil); len(touches) != 0 {
+		t.Fatalf("got %d touches of an unbound key, want 0", len(touches))
+	}
+
+	touches := tr.AppendNewTouches(nil)
+	if len(touches) != 1 {
+		t.Fatalf("got %d touches of a bound key, want 1", len(touches))
+	}
+	touches[0].Update()
+	tr.AppendNewTouches(touches)
+	touches[0].Update()
+	if x := touches[0].Position().X; x != 4 {
+		t.Errorf("got x %v, want 4", x)
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+	tr := NewTracker(NewScriptedSource([]ScriptedFrame{
+		{Keys: []ebiten.Key{ebiten.KeyArrowRight}},
+		{Keys: []ebiten.Key{ebiten.KeyArrowRight}},
+		{Keys: []ebiten.Key{ebiten.KeyArrowRight}},
+	}), 4)
+
+	if touches := tr.AppendNewTouches(nil); len(touches) != 1 {
+		t.Fatalf("got %d touches, want 1", len(touches))
+	}
+
+	// The touches are dropped while the key is held.
+	if touches := tr.AppendNewTouches(nil); len(touches) != 0 {
+		t.Fatalf("got %d touches before reset, want 0", len(touches))
+	}
+
+	tr.Reset()
+	if touches := tr.AppendNewTouches(nil); len(touches) != 1 {
+		t.Errorf("got %d touches after reset, want 1", len(touches))
+	}
+}